@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/apex/log"
+	"github.com/fgrosse/goldi"
+	"github.com/spf13/cobra"
+	"manala/pkg/project"
+	"manala/pkg/repository"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+/*********/
+/* Cobra */
+/*********/
+
+func CacheCobra(container *goldi.Container) *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage repositories cache",
+		Long: `Cache (manala cache) will manage cached repositories.
+
+Example: manala cache list -> resulting in a cached repositories list display
+Example: manala cache prune --days 30 -> resulting in the removal of repositories unused for 30 days
+Example: manala cache clear -> resulting in the removal of all cached repositories`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List cached repositories",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			container.MustGet("cmd.cache").(*CacheCmd).RunList()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "info",
+		Short: "Show cache information",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			container.MustGet("cmd.cache").(*CacheCmd).RunInfo()
+		},
+	})
+
+	var pruneOpt CachePruneOptions
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove unused cached repositories",
+		Long: `Prune (manala cache prune) will remove cached repositories
+either unused for a number of days, or not referenced by any project
+found recursively in a directory. Repositories cached without any
+source or use information are only reported, unless --all is set.
+
+Example: manala cache prune --days 30 -> resulting in the removal of repositories unused for 30 days
+Example: manala cache prune --unreferenced /foo -> resulting in the removal of repositories not referenced by projects in /foo directory`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			container.MustGet("cmd.cache").(*CacheCmd).RunPrune(pruneOpt)
+		},
+	}
+
+	pruneCmd.Flags().IntVar(&pruneOpt.Days, "days", 0, "Remove repositories unused for this number of days")
+	pruneCmd.Flags().StringVar(&pruneOpt.Unreferenced, "unreferenced", "", "Remove repositories not referenced by any project in this directory")
+	pruneCmd.Flags().BoolVar(&pruneOpt.All, "all", false, "Also remove repositories cached without source or use information")
+
+	cmd.AddCommand(pruneCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Remove all cached repositories",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			container.MustGet("cmd.cache").(*CacheCmd).RunClear()
+		},
+	})
+
+	return cmd
+}
+
+/***********/
+/* Options */
+/***********/
+
+type CachePruneOptions struct {
+	Days         int
+	Unreferenced string
+	All          bool
+}
+
+/***********/
+/* Command */
+/***********/
+
+type CacheCmd struct {
+	RepositoryManager repository.ManagerInterface
+	ProjectManager    project.ManagerInterface
+	// Repositories sources used by projects without their own
+	RepositorySrcs []string
+	Logger         log.Interface
+}
+
+func (cmd *CacheCmd) RunList() {
+	caches, err := cmd.RepositoryManager.ListCache()
+	if err != nil {
+		cmd.Logger.WithError(err).Fatal("Error listing cache")
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "SOURCE\tREF\tLAST FETCH\tLAST USE\tSIZE")
+	for _, cached := range caches {
+		src := cached.Src
+		if src == "" {
+			src = "unknown (" + cached.Dir + ")"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", src, cached.Ref, formatTime(cached.LastFetch), formatTime(cached.LastUse), formatSize(cached.Size))
+	}
+
+	if err := writer.Flush(); err != nil {
+		cmd.Logger.WithError(err).Fatal("Error printing cache")
+	}
+}
+
+func (cmd *CacheCmd) RunInfo() {
+	caches, err := cmd.RepositoryManager.ListCache()
+	if err != nil {
+		cmd.Logger.WithError(err).Fatal("Error listing cache")
+	}
+
+	var size int64
+	for _, cached := range caches {
+		size += cached.Size
+	}
+
+	fmt.Printf("Repositories: %d\n", len(caches))
+	fmt.Printf("Size: %s\n", formatSize(size))
+}
+
+func (cmd *CacheCmd) RunPrune(opt CachePruneOptions) {
+	if opt.Days <= 0 && opt.Unreferenced == "" {
+		cmd.Logger.Fatal("Either days or unreferenced must be set")
+	}
+
+	caches, err := cmd.RepositoryManager.ListCache()
+	if err != nil {
+		cmd.Logger.WithError(err).Fatal("Error listing cache")
+	}
+
+	// Repositories, by source and ref, referenced by projects
+	var referenced map[string]bool
+	if opt.Unreferenced != "" {
+		dir, err := getRealDir(opt.Unreferenced)
+		if err != nil {
+			cmd.Logger.WithError(err).Fatal("Error getting real directory")
+		}
+
+		referenced, err = cmd.referencedRepositories(dir)
+		if err != nil {
+			cmd.Logger.WithError(err).Fatal("Error finding projects recursively")
+		}
+	}
+
+	pruned := 0
+
+	for _, cached := range caches {
+		logger := cmd.Logger.WithFields(log.Fields{
+			"src": cached.Src,
+			"ref": cached.Ref,
+		})
+
+		switch {
+		case (cached.Src == "" || cached.LastUse.IsZero()) && !opt.All:
+			// Neither its use nor its references could be told apart
+			cmd.Logger.WithField("dir", cached.Dir).Warn("Skipping repository of unknown source or use")
+			continue
+		case opt.Days > 0 && time.Since(cached.LastUse) > time.Duration(opt.Days)*24*time.Hour:
+			logger.Info("Pruning unused repository...")
+		case referenced != nil && !referenced[cacheKey(cached.Src, cached.Ref)]:
+			logger.Info("Pruning unreferenced repository...")
+		default:
+			continue
+		}
+
+		if err := cmd.RepositoryManager.RemoveCache(cached); err != nil {
+			logger.WithError(err).Fatal("Error pruning repository")
+		}
+
+		pruned++
+	}
+
+	cmd.Logger.WithField("count", pruned).Info("Cache pruned")
+}
+
+func (cmd *CacheCmd) RunClear() {
+	if err := cmd.RepositoryManager.ClearCache(); err != nil {
+		cmd.Logger.WithError(err).Fatal("Error clearing cache")
+	}
+
+	cmd.Logger.Info("Cache cleared")
+}
+
+// Find cached repositories referenced by projects in dir, keyed by cache source and ref
+func (cmd *CacheCmd) referencedRepositories(dir string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+
+	// Nested projects also reference repositories
+	err := cmd.ProjectManager.Walk(dir, project.WalkOptions{Nested: true}, func(prj *project.ManagedProject) {
+		srcs := cmd.RepositorySrcs
+		if prj.GetRepository() != "" {
+			srcs = []string{prj.GetRepository()}
+		}
+
+		for _, src := range srcs {
+			if src, ok := cmd.RepositoryManager.CacheSrc(src); ok {
+				referenced[cacheKey(src, prj.GetRef())] = true
+			}
+		}
+	})
+
+	return referenced, err
+}
+
+func cacheKey(src string, ref string) string {
+	return src + "#" + ref
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// Format size in human readable units
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
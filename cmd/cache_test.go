@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"manala/pkg/project"
+	"manala/pkg/repository"
+	"testing"
+	"time"
+)
+
+// Repository manager whose cache is faked
+type cacheRepositoryManager struct {
+	repository.ManagerInterface
+	caches  []*repository.CachedRepository
+	removed []string
+}
+
+func (mgr *cacheRepositoryManager) ListCache() ([]*repository.CachedRepository, error) {
+	return mgr.caches, nil
+}
+
+func (mgr *cacheRepositoryManager) RemoveCache(cached *repository.CachedRepository) error {
+	mgr.removed = append(mgr.removed, cached.Src+"#"+cached.Ref)
+	return nil
+}
+
+func Test_CacheCmd_RunPrune_unreferenced(t *testing.T) {
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	repositoryManager := &cacheRepositoryManager{
+		ManagerInterface: repository.NewManager(afero.NewOsFs(), logger, "", false, repository.Options{
+			Aliases: map[string]string{"company": "https://example.com/company.git//templates"},
+		}),
+	}
+	for _, cached := range []struct{ src, ref string }{
+		{"https://example.com/foo.git", ""},
+		{"https://example.com/bar.git", ""},
+		{"https://example.com/company.git", "v1.0.0"},
+		{"https://example.com/company.git", ""},
+		{"https://example.com/baz.git", ""},
+	} {
+		repositoryManager.caches = append(repositoryManager.caches, &repository.CachedRepository{
+			Src:     cached.src,
+			Ref:     cached.ref,
+			LastUse: time.Now(),
+		})
+	}
+
+	cmd := &CacheCmd{
+		RepositoryManager: repositoryManager,
+		ProjectManager:    project.NewManager(afero.NewOsFs(), logger, project.Options{}),
+		RepositorySrcs:    []string{"https://example.com/default.git"},
+		Logger:            logger,
+	}
+
+	cmd.RunPrune(CachePruneOptions{Unreferenced: "testdata/cache/prune"})
+
+	assert.Equal(t, []string{
+		"https://example.com/company.git#",
+		"https://example.com/baz.git#",
+	}, repositoryManager.removed)
+}
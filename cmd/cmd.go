@@ -1,10 +1,67 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+	"manala/pkg/project"
+	"manala/pkg/repository"
 	"os"
 	"path/filepath"
 )
 
+/**********/
+/* Errors */
+/**********/
+
+var (
+	ErrUntrustedRepository = errors.New("repository not trusted")
+)
+
+/**************/
+/* Exit codes */
+/**************/
+
+const (
+	// Check mode found a project out of sync
+	ExitCodeOutOfSync = 2
+)
+
+/***************/
+/* Annotations */
+/***************/
+
+// Commands whose optional first argument is their target directory,
+// so that local config file is searched from it rather than from current one
+const DirArgAnnotation = "dir_arg"
+
+// Get a log entry for err, suggesting a remedy for repository errors
+func withError(logger log.Interface, err error) *log.Entry {
+	entry := logger.WithError(err)
+
+	var repErr *repository.Error
+	if errors.As(err, &repErr) {
+		if remedy := repErr.Remedy(); remedy != "" {
+			entry = entry.WithField("remedy", remedy)
+		}
+	}
+
+	return entry
+}
+
+// Add recursive mode projects walk flags
+func addWalkFlags(flags *pflag.FlagSet, opt *project.WalkOptions) {
+	flags.IntVar(&opt.MaxDepth, "max-depth", 0, "Maximum depth of directories searched for projects, in recursive mode (unlimited if 0)")
+	flags.BoolVar(&opt.Nested, "nested", false, "Search for projects nested into found ones, in recursive mode")
+	flags.StringSliceVar(&opt.Filter.Templates, "template", nil, "Only projects whose template matches this glob, in recursive mode")
+	flags.StringVar(&opt.Filter.Repository, "from-repository", "", "Only projects whose repository, or any of the default ones, matches this glob, in recursive mode")
+	flags.StringSliceVar(&opt.Filter.Paths, "path", nil, "Only projects whose path, relative to dir, matches this glob, in recursive mode")
+	flags.StringSliceVar(&opt.Filter.ExcludePaths, "exclude-path", nil, "Exclude projects whose path, relative to dir, matches this glob, in recursive mode")
+}
+
 func getRealDir(dir string) (string, error) {
 	if dir == "" {
 		dir, err := os.Getwd()
@@ -24,3 +81,25 @@ func getRealDir(dir string) (string, error) {
 
 	return dir, nil
 }
+
+func printJson(v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(content))
+
+	return nil
+}
+
+func printYaml(v interface{}) error {
+	content, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(string(content))
+
+	return nil
+}
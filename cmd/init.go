@@ -8,6 +8,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"manala/pkg/project"
+	"manala/pkg/repository"
 	"manala/pkg/syncer"
 	"manala/pkg/template"
 	"path"
@@ -32,7 +33,8 @@ A optional dir could be passed as argument.
 
 Example: manala init -> resulting in an init in current directory
 Example: manala init /foo/bar -> resulting in an init in /foo/bar directory`,
-		Args: cobra.MaximumNArgs(1),
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{DirArgAnnotation: ""},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) < 1 {
 				args = append(args, "")
@@ -76,14 +78,23 @@ func (cmd *InitCmd) Run(dir string, opt InitOptions) {
 	}
 
 	var templates []template.Interface
+	var names []string
+	var repositorySrcs []string
 
 	// Walk into templates
 	err = cmd.TemplateManager.Walk(func(tmpl *template.ManagedTemplate) {
 		templates = append(templates, tmpl)
+		// Templates shadowed by higher priority repositories ones must be qualified
+		name := tmpl.GetName()
+		if containsString(names, name) {
+			name = tmpl.GetQualifiedName()
+		}
+		names = append(names, name)
+		repositorySrcs = append(repositorySrcs, tmpl.GetRepository().GetSrc())
 	})
 
 	if err != nil {
-		cmd.Logger.WithError(err).Fatal("Error walking templates")
+		withError(cmd.Logger, err).Fatal("Error walking templates")
 	}
 
 	prompt := promptui.Select{
@@ -121,7 +132,14 @@ func (cmd *InitCmd) Run(dir string, opt InitOptions) {
 
 	// Create project config
 	cfg := project.Config{
-		Template: templates[i].GetName(),
+		Template: names[i],
+	}
+
+	// Builtin templates, only used as a fallback, are pinned to their repository,
+	// so that projects keep being synced from it
+	if repositorySrcs[i] == repository.BuiltinSrc {
+		cfg.Template = templates[i].GetName()
+		cfg.Repository = repository.BuiltinSrc
 	}
 
 	cfgContent, err := yaml.Marshal(map[string]project.Config{
@@ -138,4 +156,17 @@ func (cmd *InitCmd) Run(dir string, opt InitOptions) {
 	if err != nil {
 		cmd.Logger.WithError(err).Fatal("Error writing project configuration")
 	}
+
+	// Lock project at template version, so that none of its past migrations ever applies
+	if version := templates[i].GetVersion(); version != "" {
+		prj, err := cmd.ProjectManager.Get(dir)
+		if err != nil {
+			cmd.Logger.WithError(err).Fatal("Error getting project")
+		}
+
+		err = cmd.ProjectManager.SaveLock(prj, &project.Lock{Version: version})
+		if err != nil {
+			cmd.Logger.WithError(err).Fatal("Error writing project lock")
+		}
+	}
 }
@@ -6,6 +6,10 @@ import (
 	"github.com/fgrosse/goldi"
 	"github.com/spf13/cobra"
 	"manala/pkg/template"
+	"os"
+	"strings"
+	"text/tabwriter"
+	engine "text/template"
 )
 
 /*********/
@@ -23,13 +27,22 @@ func ListCobra(container *goldi.Container) *cobra.Command {
 		Long: `List (manala list) will list templates available on
 repository.
 
-Example: manala list -> resulting in a template list display`,
+Output could be json, yaml, or table. A go template could also be
+used as format, each template being described by the following fields:
+Name, Description, Dir, Repository, Sync, Options, Tags.
+
+Example: manala list -> resulting in a template list display
+Example: manala list --output json -> resulting in a template list json display
+Example: manala list --format "{{ .Name }} {{ .Repository }}" -> resulting in a custom template list display`,
 		Args: cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			container.MustGet("cmd.list").(*ListCmd).Run(opt)
 		},
 	}
 
+	cmd.Flags().StringVarP(&opt.Output, "output", "o", "", "Output (json, yaml or table)")
+	cmd.Flags().StringVarP(&opt.Format, "format", "f", "", "Go template format")
+
 	return cmd
 }
 
@@ -38,6 +51,8 @@ Example: manala list -> resulting in a template list display`,
 /***********/
 
 type ListOptions struct {
+	Output string
+	Format string
 }
 
 /***********/
@@ -49,13 +64,82 @@ type ListCmd struct {
 	Logger          log.Interface
 }
 
+// Template, as exposed by list outputs
+type listTemplate struct {
+	Name        string              `json:"name" yaml:"name"`
+	Description string              `json:"description" yaml:"description"`
+	Dir         string              `json:"dir" yaml:"dir"`
+	Repository  string              `json:"repository" yaml:"repository"`
+	Sync        []template.SyncUnit `json:"sync" yaml:"sync"`
+	Options     []template.Option   `json:"options" yaml:"options"`
+	Tags        []string            `json:"tags" yaml:"tags"`
+}
+
 func (cmd *ListCmd) Run(opt ListOptions) {
+	var format *engine.Template
+	if opt.Format != "" {
+		var err error
+		format, err = engine.New("format").Parse(opt.Format)
+		if err != nil {
+			cmd.Logger.WithError(err).Fatal("Error parsing format")
+		}
+	}
+
+	var templates []*listTemplate
+	var names []string
+
 	// Walk into templates
 	err := cmd.TemplateManager.Walk(func(tmpl *template.ManagedTemplate) {
-		fmt.Printf("%s: %s\n", tmpl.GetName(), tmpl.GetDescription())
+		// Templates shadowed by higher priority repositories ones must be qualified
+		name := tmpl.GetName()
+		if containsString(names, name) {
+			name = tmpl.GetQualifiedName()
+		}
+		names = append(names, name)
+
+		templates = append(templates, &listTemplate{
+			Name:        name,
+			Description: tmpl.GetDescription(),
+			Dir:         tmpl.GetDir(),
+			Repository:  tmpl.GetRepository().GetSrc(),
+			Sync:        tmpl.GetSync(),
+			Options:     tmpl.GetOptions(),
+			Tags:        tmpl.GetTags(),
+		})
 	})
 
 	if err != nil {
-		cmd.Logger.WithError(err).Fatal("Error walking templates")
+		withError(cmd.Logger, err).Fatal("Error walking templates")
+	}
+
+	switch {
+	case format != nil:
+		for _, tmpl := range templates {
+			if err := format.Execute(os.Stdout, tmpl); err != nil {
+				cmd.Logger.WithError(err).Fatal("Error formatting template")
+			}
+			fmt.Println()
+		}
+	case opt.Output == "json":
+		err = printJson(templates)
+	case opt.Output == "yaml":
+		err = printYaml(templates)
+	case opt.Output == "table":
+		writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAME\tDESCRIPTION\tREPOSITORY\tTAGS")
+		for _, tmpl := range templates {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", tmpl.Name, tmpl.Description, tmpl.Repository, strings.Join(tmpl.Tags, ","))
+		}
+		err = writer.Flush()
+	case opt.Output == "":
+		for _, tmpl := range templates {
+			fmt.Printf("%s: %s\n", tmpl.Name, tmpl.Description)
+		}
+	default:
+		cmd.Logger.WithField("output", opt.Output).Fatal("Unsupported output")
+	}
+
+	if err != nil {
+		cmd.Logger.WithError(err).Fatal("Error printing templates")
 	}
 }
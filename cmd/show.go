@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/apex/log"
+	"github.com/fgrosse/goldi"
+	"github.com/spf13/cobra"
+	"manala/pkg/template"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+/*********/
+/* Cobra */
+/*********/
+
+func ShowCobra(container *goldi.Container) *cobra.Command {
+
+	var opt ShowOptions
+
+	cmd := &cobra.Command{
+		Use:     "show TEMPLATE",
+		Aliases: []string{"sh"},
+		Short:   "Show template",
+		Long: `Show (manala show) will describe a template available on
+repository: its sync units, declared options, parent templates and
+repository commit.
+
+Example: manala show foo -> resulting in a foo template display
+Example: manala show foo --output json -> resulting in a foo template json display`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			container.MustGet("cmd.show").(*ShowCmd).Run(args[0], opt)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opt.Output, "output", "o", "", "Output (json or yaml)")
+
+	return cmd
+}
+
+/***********/
+/* Options */
+/***********/
+
+type ShowOptions struct {
+	Output string
+}
+
+/***********/
+/* Command */
+/***********/
+
+type ShowCmd struct {
+	TemplateManager template.ManagerInterface
+	Logger          log.Interface
+}
+
+// Template, as exposed by show outputs
+type showTemplate struct {
+	Name        string              `json:"name" yaml:"name"`
+	Description string              `json:"description" yaml:"description"`
+	Version     string              `json:"version,omitempty" yaml:"version,omitempty"`
+	Dir         string              `json:"dir" yaml:"dir"`
+	Repository  string              `json:"repository" yaml:"repository"`
+	Commit      string              `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Tags        []string            `json:"tags" yaml:"tags"`
+	Parents     []string            `json:"parents" yaml:"parents"`
+	Sync        []template.SyncUnit `json:"sync" yaml:"sync"`
+	Options     []template.Option   `json:"options" yaml:"options"`
+}
+
+func (cmd *ShowCmd) Run(name string, opt ShowOptions) {
+	// Get template
+	tmpl, err := cmd.TemplateManager.Get(name)
+	if err != nil {
+		withError(cmd.Logger, err).WithField("template", name).Fatal("Error getting template")
+	}
+
+	show := &showTemplate{
+		Name:        tmpl.GetName(),
+		Description: tmpl.GetDescription(),
+		Version:     tmpl.GetVersion(),
+		Dir:         tmpl.GetDir(),
+		Repository:  tmpl.GetRepository().GetSrc(),
+		Commit:      tmpl.GetRepository().GetCommit(),
+		Tags:        tmpl.GetTags(),
+		Options:     tmpl.GetOptions(),
+	}
+
+	// Resolve sync units, and parent templates they come from
+	for _, unit := range tmpl.GetSync() {
+		if unit.Template == "" {
+			unit.Template = tmpl.GetName()
+		} else {
+			// Ensure parent template exists, resolved the same way syncs do
+			if _, err := template.GetParent(cmd.TemplateManager, tmpl, unit.Template); err != nil {
+				withError(cmd.Logger, err).WithField("template", unit.Template).Fatal("Error getting parent template")
+			}
+			if !containsString(show.Parents, unit.Template) {
+				show.Parents = append(show.Parents, unit.Template)
+			}
+		}
+		show.Sync = append(show.Sync, unit)
+	}
+
+	switch opt.Output {
+	case "json":
+		err = printJson(show)
+	case "yaml":
+		err = printYaml(show)
+	case "":
+		err = cmd.print(show)
+	default:
+		cmd.Logger.WithField("output", opt.Output).Fatal("Unsupported output")
+	}
+
+	if err != nil {
+		cmd.Logger.WithError(err).Fatal("Error printing template")
+	}
+}
+
+func (cmd *ShowCmd) print(show *showTemplate) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+
+	fmt.Fprintf(writer, "Name:\t%s\n", show.Name)
+	fmt.Fprintf(writer, "Description:\t%s\n", show.Description)
+	if show.Version != "" {
+		fmt.Fprintf(writer, "Version:\t%s\n", show.Version)
+	}
+	fmt.Fprintf(writer, "Dir:\t%s\n", show.Dir)
+	fmt.Fprintf(writer, "Repository:\t%s\n", show.Repository)
+	if show.Commit != "" {
+		fmt.Fprintf(writer, "Commit:\t%s\n", show.Commit)
+	}
+	if len(show.Tags) > 0 {
+		fmt.Fprintf(writer, "Tags:\t%s\n", strings.Join(show.Tags, ", "))
+	}
+	if len(show.Parents) > 0 {
+		fmt.Fprintf(writer, "Parents:\t%s\n", strings.Join(show.Parents, ", "))
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if len(show.Sync) > 0 {
+		fmt.Println("Sync:")
+		for _, unit := range show.Sync {
+			fmt.Fprintf(writer, "  %s:%s\t-> %s\n", unit.Template, unit.Source, unit.Destination)
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(show.Options) > 0 {
+		fmt.Println("Options:")
+		for _, option := range show.Options {
+			fmt.Fprintf(writer, "  %s\t", option.Name)
+			if option.Default != nil {
+				fmt.Fprintf(writer, "(default: %v)", option.Default)
+			}
+			fmt.Fprintf(writer, "\t%s\n", option.Description)
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
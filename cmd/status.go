@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/apex/log"
+	"github.com/fgrosse/goldi"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"manala/pkg/project"
+	"manala/pkg/syncer"
+	"manala/pkg/template"
+	"os"
+	"sort"
+)
+
+/*********/
+/* Cobra */
+/*********/
+
+func StatusCobra(container *goldi.Container) *cobra.Command {
+
+	var opt StatusOptions
+
+	cmd := &cobra.Command{
+		Use:     "status [DIR]",
+		Aliases: []string{"st"},
+		Short:   "Show project status",
+		Long: `Status (manala status) will show whether project is up to
+date with its template, without modifying anything.
+
+Files could be missing, out of date, locally modified or orphaned.
+
+A optional dir could be passed as argument.
+
+Example: manala status -> resulting in a status display of project in current directory
+Example: manala status /foo/bar -> resulting in a status display of project in /foo/bar directory`,
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{DirArgAnnotation: ""},
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				args = append(args, "")
+			}
+			container.MustGet("cmd.status").(*StatusCmd).Run(args[0], opt)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opt.Recursive, "recursive", "r", false, "Recursive")
+	addWalkFlags(cmd.Flags(), &opt.Walk)
+
+	return cmd
+}
+
+/***********/
+/* Options */
+/***********/
+
+type StatusOptions struct {
+	Recursive bool
+	Walk      project.WalkOptions
+}
+
+/***********/
+/* Command */
+/***********/
+
+type StatusCmd struct {
+	ProjectManager  project.ManagerInterface
+	TemplateManager template.ManagerInterface
+	Syncer          syncer.Interface
+	Logger          log.Interface
+}
+
+type fileStatus string
+
+const (
+	fileMissing  fileStatus = "missing"
+	fileOutdated fileStatus = "out of date"
+	fileModified fileStatus = "modified"
+	fileOrphaned fileStatus = "orphaned"
+)
+
+func (cmd *StatusCmd) Run(dir string, opt StatusOptions) {
+	// Get real directory
+	dir, err := getRealDir(dir)
+	if err != nil {
+		cmd.Logger.WithError(err).Fatal("Error getting real directory")
+	}
+
+	if opt.Recursive {
+		// Recursively find projects
+		err = cmd.ProjectManager.Walk(dir, opt.Walk, func(prj *project.ManagedProject) {
+			err = cmd.statusProject(prj)
+			if err != nil {
+				withError(cmd.Logger, err).Fatal("Error getting project status")
+			}
+		})
+		if err != nil {
+			cmd.Logger.WithError(err).Fatal("Error finding projects recursively")
+		}
+	} else {
+		// Find project
+		prj, err := cmd.ProjectManager.Find(dir)
+		if err != nil {
+			cmd.Logger.WithError(err).Fatal("Error finding project")
+		}
+
+		err = cmd.statusProject(prj)
+		if err != nil {
+			withError(cmd.Logger, err).Fatal("Error getting project status")
+		}
+	}
+}
+
+func (cmd *StatusCmd) statusProject(prj *project.ManagedProject) error {
+	logger := cmd.Logger.WithField("dir", prj.GetDir())
+
+	logger.WithFields(log.Fields{
+		"template":   prj.GetTemplate(),
+		"repository": prj.GetRepository(),
+	}).Info("Project found")
+
+	tmplMgr := cmd.TemplateManager
+
+	// Custom project repository
+	if prj.GetRepository() != "" {
+		tmplMgr = tmplMgr.WithRepositorySrc(prj.GetRepository())
+	}
+
+	// Pinned project repository ref
+	if prj.GetRef() != "" {
+		tmplMgr = tmplMgr.WithRepositoryRef(prj.GetRef())
+	}
+
+	// Get project template
+	tmpl, err := tmplMgr.Get(prj.GetTemplate())
+	if err != nil {
+		return err
+	}
+
+	lock, err := cmd.ProjectManager.GetLock(prj)
+	if err != nil {
+		return err
+	}
+
+	// Compute what an update would change
+	cmd.Syncer.SetDryRun(true)
+	err = cmd.Syncer.SyncProject(prj, tmplMgr)
+	cmd.Syncer.SetDryRun(false)
+	if err != nil {
+		return err
+	}
+
+	files, err := cmd.filesStatus(prj, lock, cmd.Syncer.GetChanges(), cmd.Syncer.GetSums())
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		logger.WithFields(log.Fields{
+			"file":   path,
+			"status": files[path],
+		}).Warn("File not up to date")
+	}
+
+	// Repository
+	commit := tmpl.GetRepository().GetCommit()
+	if lock.Commit != "" && commit != "" && lock.Commit != commit {
+		logger.WithFields(log.Fields{
+			"locked": lock.Commit,
+			"commit": commit,
+		}).Warn("Repository has newer commits")
+	}
+
+	if len(files) == 0 {
+		logger.Info("Project up to date")
+	}
+
+	return nil
+}
+
+func (cmd *StatusCmd) filesStatus(prj *project.ManagedProject, lock *project.Lock, changes []*syncer.Change, sums map[string]string) (map[string]fileStatus, error) {
+	files := make(map[string]fileStatus)
+
+	for _, change := range changes {
+		switch change.Type {
+		case syncer.ChangeCreate:
+			files[change.Path] = fileMissing
+		case syncer.ChangeDelete:
+			files[change.Path] = fileOrphaned
+		case syncer.ChangeMode:
+			files[change.Path] = fileOutdated
+		case syncer.ChangeUpdate:
+			// Without a locked checksum, there is no way to tell local modifications
+			locked, ok := lock.Files[change.Path]
+			if !ok {
+				files[change.Path] = fileOutdated
+				break
+			}
+			content, err := afero.ReadFile(prj.GetFs(), change.Path)
+			if err != nil {
+				return nil, err
+			}
+			hash := md5.Sum(content)
+			if hex.EncodeToString(hash[:]) == locked {
+				files[change.Path] = fileOutdated
+			} else {
+				files[change.Path] = fileModified
+			}
+		}
+	}
+
+	// Files previously synced, but no more provided by template
+	for path := range lock.Files {
+		if _, ok := sums[path]; ok {
+			continue
+		}
+		if _, err := prj.GetFs().Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		files[path] = fileOrphaned
+	}
+
+	return files, nil
+}
@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/apex/log"
 	"github.com/fgrosse/goldi"
+	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
+	"manala/pkg/hook"
+	"manala/pkg/migrator"
 	"manala/pkg/project"
 	"manala/pkg/syncer"
 	"manala/pkg/template"
+	"os"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
 )
 
 /*********/
@@ -26,9 +34,17 @@ template and related options defined in manala.yaml.
 
 A optional dir could be passed as argument.
 
+In check mode, nothing is written; command exits with a dedicated code
+if project is out of sync.
+
 Example: manala update -> resulting in an update in current directory
-Example: manala update /foo/bar -> resulting in an update in /foo/bar directory`,
-		Args: cobra.MaximumNArgs(1),
+Example: manala update /foo/bar -> resulting in an update in /foo/bar directory
+Example: manala update --check -> resulting in a check of project in current directory
+Example: manala update -r -j 4 /foo -> resulting in an update of projects in /foo directory, 4 at a time
+Example: manala update -r -k /foo -> resulting in an update of projects in /foo directory, despite failures
+Example: manala update -r --template "php*" --exclude-path "legacy/*" /foo -> resulting in an update of php projects in /foo directory, but legacy ones`,
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{DirArgAnnotation: ""},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) < 1 {
 				args = append(args, "")
@@ -38,6 +54,11 @@ Example: manala update /foo/bar -> resulting in an update in /foo/bar directory`
 	}
 
 	cmd.Flags().BoolVarP(&opt.Recursive, "recursive", "r", false, "Recursive")
+	addWalkFlags(cmd.Flags(), &opt.Walk)
+	cmd.Flags().IntVarP(&opt.Jobs, "jobs", "j", 1, "Number of projects updated concurrently, in recursive mode")
+	cmd.Flags().BoolVarP(&opt.KeepGoing, "keep-going", "k", false, "Keep updating projects when one fails, in recursive mode, then print a summary")
+	cmd.Flags().BoolVar(&opt.NoHooks, "no-hooks", false, "Do not run template hooks")
+	cmd.Flags().BoolVar(&opt.Check, "check", false, "Only check project is in sync, without writing anything")
 
 	return cmd
 }
@@ -48,6 +69,11 @@ Example: manala update /foo/bar -> resulting in an update in /foo/bar directory`
 
 type UpdateOptions struct {
 	Recursive bool
+	Walk      project.WalkOptions
+	Jobs      int
+	KeepGoing bool
+	NoHooks   bool
+	Check     bool
 }
 
 /***********/
@@ -58,6 +84,9 @@ type UpdateCmd struct {
 	ProjectManager  project.ManagerInterface
 	TemplateManager template.ManagerInterface
 	Syncer          syncer.Interface
+	Migrator        migrator.Interface
+	HookRunner      hook.RunnerInterface
+	TrustManager    hook.TrustManagerInterface
 	Logger          log.Interface
 }
 
@@ -68,23 +97,35 @@ func (cmd *UpdateCmd) Run(dir string, opt UpdateOptions) {
 		cmd.Logger.WithError(err).Fatal("Error getting real directory")
 	}
 
+	var outOfSync int32
+
+	// Update project, telling whether it changed, or is out of sync in check mode
+	update := func(cmd *UpdateCmd, prj *project.ManagedProject) (bool, error) {
+		if !opt.Check {
+			if err := cmd.syncProject(prj, opt); err != nil {
+				return false, err
+			}
+			return len(cmd.Syncer.GetChanges()) > 0, nil
+		}
+
+		inSync, err := cmd.checkProject(prj)
+		if !inSync {
+			atomic.StoreInt32(&outOfSync, 1)
+		}
+		return !inSync, err
+	}
+
 	if opt.Recursive {
 		// Recursively find projects
-		err = cmd.ProjectManager.Walk(dir, func(prj *project.ManagedProject) {
-			cmd.Logger.WithFields(log.Fields{
-				"template":   prj.GetTemplate(),
-				"repository": prj.GetRepository(),
-			}).Info("Project found")
-
-			// Sync
-			err = cmd.syncProject(prj)
-			if err != nil {
-				cmd.Logger.WithError(err).Fatal("Error syncing project")
-			}
+		var prjs []*project.ManagedProject
+		err = cmd.ProjectManager.Walk(dir, opt.Walk, func(prj *project.ManagedProject) {
+			prjs = append(prjs, prj)
 		})
 		if err != nil {
 			cmd.Logger.WithError(err).Fatal("Error finding projects recursively")
 		}
+
+		cmd.updateProjects(prjs, opt, update)
 	} else {
 		// Find project
 		prj, err := cmd.ProjectManager.Find(dir)
@@ -98,14 +139,245 @@ func (cmd *UpdateCmd) Run(dir string, opt UpdateOptions) {
 		}).Info("Project found")
 
 		// Sync
-		err = cmd.syncProject(prj)
+		_, err = update(cmd, prj)
 		if err != nil {
-			cmd.Logger.WithError(err).Fatal("Error syncing project")
+			withError(cmd.Logger, err).Fatal("Error syncing project")
+		}
+	}
+
+	if atomic.LoadInt32(&outOfSync) == 1 {
+		cmd.Logger.Error("Out of sync")
+		os.Exit(ExitCodeOutOfSync)
+	}
+}
+
+// Recursive update project status
+const (
+	projectSynced    = "synced"
+	projectUnchanged = "unchanged"
+	projectOutOfSync = "out of sync"
+	projectFailed    = "failed"
+	projectSkipped   = "skipped"
+)
+
+type projectResult struct {
+	prj    *project.ManagedProject
+	status string
+	err    error
+}
+
+// Update projects, each one logging with its own dir, then report results.
+// No more projects are started once one has failed, unless keep going.
+func (cmd *UpdateCmd) updateProjects(prjs []*project.ManagedProject, opt UpdateOptions, update func(cmd *UpdateCmd, prj *project.ManagedProject) (bool, error)) {
+	results := runProjects(prjs, opt.Jobs, opt.KeepGoing, opt.Check, func(prj *project.ManagedProject) (bool, error) {
+		prjCmd := cmd.withLogger(cmd.Logger.WithField("dir", prj.GetDir()))
+
+		prjCmd.Logger.WithFields(log.Fields{
+			"template":   prj.GetTemplate(),
+			"repository": prj.GetRepository(),
+		}).Info("Project found")
+
+		changed, err := update(prjCmd, prj)
+		if err != nil {
+			withError(prjCmd.Logger, err).Error("Error syncing project")
+		}
+
+		return changed, err
+	})
+
+	if opt.KeepGoing {
+		cmd.printResults(results)
+	}
+
+	updated, failed, err := countResults(results)
+
+	logger := cmd.Logger.WithFields(log.Fields{
+		"projects": len(prjs),
+		"updated":  updated,
+	})
+
+	if err != nil {
+		if opt.KeepGoing {
+			logger.WithField("failed", failed).Fatal("Error syncing projects")
+		}
+		withError(logger, err).Fatal("Error syncing projects")
+	}
+
+	logger.Info("Projects updated")
+}
+
+// Run update on projects, concurrently by a pool of jobs, returning their results in projects order.
+// No more projects are started once one has failed, unless keep going.
+func runProjects(prjs []*project.ManagedProject, jobs int, keepGoing bool, check bool, update func(prj *project.ManagedProject) (bool, error)) []projectResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]projectResult, len(prjs))
+	for i, prj := range prjs {
+		results[i] = projectResult{prj: prj, status: projectSkipped}
+	}
+
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	failed := false
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				mutex.Lock()
+				stop := failed && !keepGoing
+				mutex.Unlock()
+				if stop {
+					continue
+				}
+
+				changed, err := update(prjs[i])
+
+				result := projectResult{prj: prjs[i], err: err}
+				switch {
+				case err != nil:
+					result.status = projectFailed
+				case changed && check:
+					result.status = projectOutOfSync
+				case changed:
+					result.status = projectSynced
+				default:
+					result.status = projectUnchanged
+				}
+
+				mutex.Lock()
+				results[i] = result
+				if err != nil {
+					failed = true
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for i := range prjs {
+		mutex.Lock()
+		stop := failed && !keepGoing
+		mutex.Unlock()
+		if stop {
+			break
 		}
+		queue <- i
+	}
+
+	close(queue)
+	wg.Wait()
+
+	return results
+}
+
+// Count updated and failed projects results, along with the first failure error
+func countResults(results []projectResult) (int, int, error) {
+	updated, failed := 0, 0
+	var err error
+
+	for _, result := range results {
+		switch result.status {
+		case projectSkipped:
+		case projectFailed:
+			failed++
+			if err == nil {
+				err = result.err
+			}
+		default:
+			updated++
+		}
+	}
+
+	return updated, failed, err
+}
+
+// Print recursive update results summary
+func (cmd *UpdateCmd) printResults(results []projectResult) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "DIR\tSTATUS\tREASON")
+	for _, result := range results {
+		reason := ""
+		if result.err != nil {
+			reason = result.err.Error()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", result.prj.GetDir(), result.status, reason)
+	}
+
+	if err := writer.Flush(); err != nil {
+		cmd.Logger.WithError(err).Error("Error printing results")
+	}
+}
+
+// Get a command copy logging with logger, with its own syncer state
+func (cmd *UpdateCmd) withLogger(logger log.Interface) *UpdateCmd {
+	prjCmd := *cmd
+	prjCmd.Syncer = cmd.Syncer.WithLogger(logger)
+	prjCmd.Logger = logger
+
+	return &prjCmd
+}
+
+// Check project is in sync with its template, rendering it in memory only
+func (cmd *UpdateCmd) checkProject(prj *project.ManagedProject) (bool, error) {
+	tmplMgr := cmd.TemplateManager
+
+	// Custom project repository
+	if prj.GetRepository() != "" {
+		tmplMgr = tmplMgr.WithRepositorySrc(prj.GetRepository())
+	}
+
+	// Pinned project repository ref
+	if prj.GetRef() != "" {
+		tmplMgr = tmplMgr.WithRepositoryRef(prj.GetRef())
+	}
+
+	// Get project template
+	tmpl, err := tmplMgr.Get(prj.GetTemplate())
+	if err != nil {
+		return false, err
 	}
+
+	migrations, err := cmd.Migrator.GetPendingMigrations(prj, tmpl)
+	if err != nil {
+		return false, err
+	}
+
+	for _, migration := range migrations {
+		cmd.Logger.WithField("version", migration.Version).Warn("Migration pending")
+	}
+
+	cmd.Syncer.SetDryRun(true)
+	err = cmd.Syncer.SyncProject(prj, tmplMgr)
+	cmd.Syncer.SetDryRun(false)
+	if err != nil {
+		return false, err
+	}
+
+	changes := cmd.Syncer.GetChanges()
+
+	for _, change := range changes {
+		cmd.Logger.WithFields(log.Fields{
+			"file":   change.Path,
+			"change": change.Type,
+		}).Warn("File out of sync")
+	}
+
+	if len(migrations) > 0 || len(changes) > 0 {
+		return false, nil
+	}
+
+	cmd.Logger.Info("Project in sync")
+
+	return true, nil
 }
 
-func (cmd *UpdateCmd) syncProject(prj project.Interface) error {
+func (cmd *UpdateCmd) syncProject(prj *project.ManagedProject, opt UpdateOptions) error {
 	tmplMgr := cmd.TemplateManager
 
 	// Custom project repository
@@ -113,12 +385,138 @@ func (cmd *UpdateCmd) syncProject(prj project.Interface) error {
 		tmplMgr = tmplMgr.WithRepositorySrc(prj.GetRepository())
 	}
 
+	// Pinned project repository ref
+	if prj.GetRef() != "" {
+		tmplMgr = tmplMgr.WithRepositoryRef(prj.GetRef())
+	}
+
+	// Get project template
+	tmpl, err := tmplMgr.Get(prj.GetTemplate())
+	if err != nil {
+		return err
+	}
+
+	// Migrate
+	migrated, err := cmd.Migrator.MigrateProject(prj, tmpl)
+	if err != nil {
+		return err
+	}
+
+	// Reload migrated project, as its options may have changed
+	if migrated {
+		prj, err = cmd.ProjectManager.Get(prj.GetDir())
+		if err != nil {
+			return err
+		}
+	}
+
+	err = cmd.syncTemplate(prj, tmpl, tmplMgr, opt)
+	if err != nil {
+		return err
+	}
+
+	// Lock
+	lock, err := cmd.ProjectManager.GetLock(prj)
+	if err != nil {
+		return err
+	}
+
+	lock.Version = tmpl.GetVersion()
+	lock.Commit = tmpl.GetRepository().GetCommit()
+	lock.Files = cmd.Syncer.GetSums()
+
+	return cmd.ProjectManager.SaveLock(prj, lock)
+}
+
+func (cmd *UpdateCmd) syncTemplate(prj *project.ManagedProject, tmpl *template.ManagedTemplate, tmplMgr template.ManagerInterface, opt UpdateOptions) error {
+	hooks := tmpl.GetHooks()
+
+	if opt.NoHooks || (len(hooks.PreSync) == 0 && len(hooks.PostSync) == 0) {
+		err := cmd.Syncer.SyncProject(prj, tmplMgr)
+		if err != nil {
+			return err
+		}
+
+		cmd.Logger.Info("Project synced")
+
+		return nil
+	}
+
+	// Hooks only run when files actually change
+	cmd.Syncer.SetDryRun(true)
 	err := cmd.Syncer.SyncProject(prj, tmplMgr)
+	cmd.Syncer.SetDryRun(false)
+	if err != nil {
+		return err
+	}
+
+	if len(cmd.Syncer.GetChanges()) == 0 {
+		cmd.Logger.Info("Project already up to date")
+		return nil
+	}
+
+	err = cmd.trustRepository(tmpl.GetRepository().GetSrc())
+	if err != nil {
+		return err
+	}
+
+	err = cmd.runHooks(prj, hooks.PreSync)
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Syncer.SyncProject(prj, tmplMgr)
 	if err != nil {
 		return err
 	}
 
 	cmd.Logger.Info("Project synced")
 
-	return nil
+	return cmd.runHooks(prj, hooks.PostSync)
+}
+
+// Concurrent projects syncs must not prompt at the same time
+var trustMutex sync.Mutex
+
+// Ensure repository is trusted before running its templates hooks, prompting if necessary
+func (cmd *UpdateCmd) trustRepository(src string) error {
+	trustMutex.Lock()
+	defer trustMutex.Unlock()
+
+	trusted, err := cmd.TrustManager.IsTrusted(src)
+	if err != nil || trusted {
+		return err
+	}
+
+	prompt := promptui.Prompt{
+		Label:     "Repository \"" + src + "\" templates want to run hooks. Trust it",
+		IsConfirm: true,
+	}
+
+	_, err = prompt.Run()
+	if err != nil {
+		switch err {
+		case promptui.ErrAbort:
+			return ErrUntrustedRepository
+		case promptui.ErrInterrupt:
+			cmd.Logger.Fatal("Interruption")
+		}
+		return err
+	}
+
+	return cmd.TrustManager.Trust(src)
+}
+
+// Render hooks commands with project options, then run them in project dir
+func (cmd *UpdateCmd) runHooks(prj *project.ManagedProject, commands []string) error {
+	var rendered []string
+	for _, command := range commands {
+		content, err := cmd.Syncer.Render("hook", []byte(command), prj.GetOptions())
+		if err != nil {
+			return err
+		}
+		rendered = append(rendered, string(content))
+	}
+
+	return cmd.HookRunner.Run(prj.GetDir(), rendered)
 }
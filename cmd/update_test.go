@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"manala/pkg/project"
+	"testing"
+)
+
+func Test_runProjects(t *testing.T) {
+	errFoo := errors.New("foo")
+
+	type want struct {
+		statuses []string
+		updated  int
+		failed   int
+	}
+	tests := []struct {
+		name      string
+		jobs      int
+		keepGoing bool
+		check     bool
+		want      want
+	}{
+		{
+			"fail_fast",
+			1, false, false,
+			want{[]string{projectSynced, projectFailed, projectSkipped, projectSkipped}, 1, 1},
+		},
+		{
+			"keep_going",
+			1, true, false,
+			want{[]string{projectSynced, projectFailed, projectUnchanged, projectSynced}, 3, 1},
+		},
+		{
+			"keep_going_jobs",
+			4, true, false,
+			want{[]string{projectSynced, projectFailed, projectUnchanged, projectSynced}, 3, 1},
+		},
+		{
+			"check",
+			2, true, true,
+			want{[]string{projectOutOfSync, projectFailed, projectUnchanged, projectOutOfSync}, 3, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prjs := []*project.ManagedProject{{}, {}, {}, {}}
+
+			// Second project fails, third one is unchanged
+			results := runProjects(prjs, tt.jobs, tt.keepGoing, tt.check, func(prj *project.ManagedProject) (bool, error) {
+				switch prj {
+				case prjs[1]:
+					return false, errFoo
+				case prjs[2]:
+					return false, nil
+				}
+				return true, nil
+			})
+
+			var statuses []string
+			for i, result := range results {
+				assert.True(t, prjs[i] == result.prj)
+				statuses = append(statuses, result.status)
+			}
+			assert.Equal(t, tt.want.statuses, statuses)
+
+			updated, failed, err := countResults(results)
+			assert.Equal(t, tt.want.updated, updated)
+			assert.Equal(t, tt.want.failed, failed)
+			assert.Equal(t, errFoo, err)
+		})
+	}
+}
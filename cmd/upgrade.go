@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"github.com/Masterminds/semver"
+	"github.com/apex/log"
+	"github.com/fgrosse/goldi"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"manala/pkg/hook"
+	"manala/pkg/migrator"
+	"manala/pkg/project"
+	"manala/pkg/syncer"
+	"manala/pkg/template"
+	"sort"
+)
+
+/*********/
+/* Cobra */
+/*********/
+
+func UpgradeCobra(container *goldi.Container) *cobra.Command {
+
+	var opt UpgradeOptions
+
+	cmd := &cobra.Command{
+		Use:     "upgrade [DIR]",
+		Aliases: []string{"ug"},
+		Short:   "Upgrade project",
+		Long: `Upgrade (manala upgrade) will list template repository versions
+(semver tags) newer than the project pinned one, pin the project to
+the chosen one in manala.yaml, then update project.
+
+A optional dir could be passed as argument.
+
+Example: manala upgrade -> resulting in an upgrade to the latest version
+Example: manala upgrade --latest-minor -> resulting in an upgrade to the latest non breaking version
+Example: manala upgrade --to v1.4.0 -> resulting in an upgrade to v1.4.0 version
+Example: manala upgrade --to v2.0.0-rc1 -> resulting in an upgrade to v2.0.0-rc1 prerelease, never chosen otherwise
+Example: manala upgrade --list -> resulting in a newer versions list display`,
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{DirArgAnnotation: ""},
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) < 1 {
+				args = append(args, "")
+			}
+			container.MustGet("cmd.upgrade").(*UpgradeCmd).Run(args[0], opt)
+		},
+	}
+
+	cmd.Flags().StringVar(&opt.To, "to", "", "Upgrade to version")
+	cmd.Flags().BoolVar(&opt.LatestMinor, "latest-minor", false, "Upgrade to latest version of current major")
+	cmd.Flags().BoolVarP(&opt.List, "list", "l", false, "Only list newer versions")
+	cmd.Flags().BoolVar(&opt.NoHooks, "no-hooks", false, "Do not run template hooks")
+
+	return cmd
+}
+
+/***********/
+/* Options */
+/***********/
+
+type UpgradeOptions struct {
+	To          string
+	LatestMinor bool
+	List        bool
+	NoHooks     bool
+}
+
+/***********/
+/* Command */
+/***********/
+
+type UpgradeCmd struct {
+	ProjectManager  project.ManagerInterface
+	TemplateManager template.ManagerInterface
+	Syncer          syncer.Interface
+	Migrator        migrator.Interface
+	HookRunner      hook.RunnerInterface
+	TrustManager    hook.TrustManagerInterface
+	Logger          log.Interface
+}
+
+func (cmd *UpgradeCmd) Run(dir string, opt UpgradeOptions) {
+	// Get real directory
+	dir, err := getRealDir(dir)
+	if err != nil {
+		cmd.Logger.WithError(err).Fatal("Error getting real directory")
+	}
+
+	// Find project
+	prj, err := cmd.ProjectManager.Find(dir)
+	if err != nil {
+		cmd.Logger.WithError(err).Fatal("Error finding project")
+	}
+
+	cmd.Logger.WithFields(log.Fields{
+		"template":   prj.GetTemplate(),
+		"repository": prj.GetRepository(),
+		"ref":        prj.GetRef(),
+	}).Info("Project found")
+
+	tmplMgr := cmd.TemplateManager
+
+	// Custom project repository
+	if prj.GetRepository() != "" {
+		tmplMgr = tmplMgr.WithRepositorySrc(prj.GetRepository())
+	}
+
+	// Pinned project repository ref
+	if prj.GetRef() != "" {
+		tmplMgr = tmplMgr.WithRepositoryRef(prj.GetRef())
+	}
+
+	// Get project template
+	tmpl, err := tmplMgr.Get(prj.GetTemplate())
+	if err != nil {
+		withError(cmd.Logger, err).Fatal("Error getting template")
+	}
+
+	// Current version, if project is pinned to one
+	var current *semver.Version
+	if prj.GetRef() != "" {
+		current, _ = semver.NewVersion(prj.GetRef())
+	}
+
+	// Newer versions
+	versions := newerVersions(tmpl.GetRepository().GetTags(), current)
+
+	for _, version := range versions {
+		cmd.Logger.WithFields(log.Fields{
+			"version":  version.Original(),
+			"breaking": isBreaking(current, version),
+		}).Info("Version available")
+	}
+
+	if opt.List {
+		return
+	}
+
+	// Target version
+	var target *semver.Version
+	switch {
+	case opt.To != "":
+		to, err := semver.NewVersion(opt.To)
+		if err != nil {
+			cmd.Logger.WithError(err).Fatal("Error parsing version")
+		}
+		// Target version must exists, but could be older than current one
+		for _, tag := range tmpl.GetRepository().GetTags() {
+			if version, err := semver.NewVersion(tag); err == nil && version.Equal(to) {
+				target = version
+				break
+			}
+		}
+		if target == nil {
+			cmd.Logger.WithField("version", opt.To).Fatal("Version not found")
+		}
+	case opt.LatestMinor:
+		if current == nil {
+			cmd.Logger.WithField("ref", prj.GetRef()).Fatal("Project is not pinned to a version")
+		}
+		target = latestVersion(versions, current, true)
+	default:
+		target = latestVersion(versions, current, false)
+	}
+
+	if target == nil {
+		cmd.Logger.Info("Project already up to date")
+		return
+	}
+
+	if isBreaking(current, target) {
+		cmd.Logger.WithField("version", target.Original()).Warn("Upgrading to a breaking version")
+	}
+
+	// Pin project to target version
+	pinned, err := cmd.ProjectManager.RewriteConfig(prj, func(cfg yaml.MapSlice) (yaml.MapSlice, bool) {
+		for i, item := range cfg {
+			if item.Key != "manala" {
+				continue
+			}
+			manala, ok := item.Value.(yaml.MapSlice)
+			if !ok {
+				return cfg, false
+			}
+			cfg[i].Value = setMapSliceValue(manala, "ref", target.Original())
+			return cfg, true
+		}
+		return cfg, false
+	})
+	if err != nil {
+		cmd.Logger.WithError(err).Fatal("Error pinning project version")
+	}
+	if !pinned {
+		cmd.Logger.Fatal("Error pinning project version, only yaml configs holding a manala map could be rewritten")
+	}
+
+	cmd.Logger.WithField("version", target.Original()).Info("Project pinned")
+
+	// Reload project
+	prj, err = cmd.ProjectManager.Get(prj.GetDir())
+	if err != nil {
+		cmd.Logger.WithError(err).Fatal("Error getting project")
+	}
+
+	// Sync, the same way update does
+	update := &UpdateCmd{
+		ProjectManager:  cmd.ProjectManager,
+		TemplateManager: cmd.TemplateManager,
+		Syncer:          cmd.Syncer,
+		Migrator:        cmd.Migrator,
+		HookRunner:      cmd.HookRunner,
+		TrustManager:    cmd.TrustManager,
+		Logger:          cmd.Logger,
+	}
+
+	err = update.syncProject(prj, UpdateOptions{NoHooks: opt.NoHooks})
+	if err != nil {
+		withError(cmd.Logger, err).Fatal("Error syncing project")
+	}
+}
+
+// Get, sorted, semver tags newer than current version, if any.
+// Prereleases are left out, as they are only upgraded to explicitly.
+func newerVersions(tags []string, current *semver.Version) []*semver.Version {
+	var versions []*semver.Version
+	for _, tag := range tags {
+		version, err := semver.NewVersion(tag)
+		if err != nil || version.Prerelease() != "" {
+			continue
+		}
+		if current == nil || version.GreaterThan(current) {
+			versions = append(versions, version)
+		}
+	}
+	sort.Sort(semver.Collection(versions))
+
+	return versions
+}
+
+// Get latest of sorted versions, only among non breaking ones if latest minor
+func latestVersion(versions []*semver.Version, current *semver.Version, latestMinor bool) *semver.Version {
+	var latest *semver.Version
+	for _, version := range versions {
+		if latestMinor && isBreaking(current, version) {
+			continue
+		}
+		latest = version
+	}
+
+	return latest
+}
+
+// A version is breaking if its major differs from current one
+func isBreaking(current *semver.Version, version *semver.Version) bool {
+	return current != nil && version.Major() > current.Major()
+}
+
+func setMapSliceValue(m yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i, item := range m {
+		if item.Key == key {
+			m[i].Value = value
+			return m
+		}
+	}
+
+	return append(m, yaml.MapItem{Key: key, Value: value})
+}
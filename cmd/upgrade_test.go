@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_newerVersions(t *testing.T) {
+	tags := []string{"v1.2.0", "v1.0.0", "v2.0.0-rc1", "foo", "v1.1.0", "v2.0.0", "v1.3.0-beta"}
+
+	tests := []struct {
+		name    string
+		current string
+		want    []string
+	}{
+		{"not_pinned", "", []string{"v1.0.0", "v1.1.0", "v1.2.0", "v2.0.0"}},
+		{"pinned", "v1.1.0", []string{"v1.2.0", "v2.0.0"}},
+		{"latest", "v2.0.0", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var current *semver.Version
+			if tt.current != "" {
+				current, _ = semver.NewVersion(tt.current)
+			}
+
+			var got []string
+			for _, version := range newerVersions(tags, current) {
+				got = append(got, version.Original())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_latestVersion(t *testing.T) {
+	current, _ := semver.NewVersion("v1.1.0")
+	versions := newerVersions([]string{"v1.2.0", "v1.3.0-rc1", "v2.0.0", "v2.1.0-rc1"}, current)
+
+	tests := []struct {
+		name        string
+		versions    []*semver.Version
+		latestMinor bool
+		want        string
+	}{
+		{"latest", versions, false, "v2.0.0"},
+		{"latest_minor", versions, true, "v1.2.0"},
+		{"none", nil, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if version := latestVersion(tt.versions, current, tt.latestMinor); version != nil {
+				got = version.Original()
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
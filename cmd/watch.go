@@ -32,7 +32,8 @@ A optional dir could be passed as argument.
 
 Example: manala watch -> resulting in an watch in current directory
 Example: manala watch /foo/bar -> resulting in an watch in /foo/bar directory`,
-		Args: cobra.MaximumNArgs(1),
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: map[string]string{DirArgAnnotation: ""},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) < 1 {
 				args = append(args, "")
@@ -112,7 +113,7 @@ func (cmd *WatchCmd) Run(dir string, opt WatchOptions) {
 
 	err = syncProject()
 	if err != nil {
-		cmd.Logger.WithError(err).Fatal("Error syncing project")
+		withError(cmd.Logger, err).Fatal("Error syncing project")
 	}
 
 	cmd.Logger.Info("Project synced")
@@ -150,7 +151,7 @@ func (cmd *WatchCmd) Run(dir string, opt WatchOptions) {
 					if modified {
 						err = syncProject()
 						if err != nil {
-							cmd.Logger.WithError(err).Error("Error syncing project")
+							withError(cmd.Logger, err).Error("Error syncing project")
 							if opt.Notify {
 								err = beeep.Alert("Manala", strings.Replace(err.Error(), `"`, `\"`, -1), "")
 								if err != nil {
@@ -196,6 +197,11 @@ func (cmd *WatchCmd) syncProjectFunc(dir string, watcher *fsnotify.Watcher, watc
 			tmplMgr = tmplMgr.WithRepositorySrc(prj.GetRepository())
 		}
 
+		// Pinned project repository ref
+		if prj.GetRef() != "" {
+			tmplMgr = tmplMgr.WithRepositoryRef(prj.GetRef())
+		}
+
 		if watchTemplate {
 			// Get project template
 			tmpl, err := tmplMgr.Get(prj.GetTemplate())
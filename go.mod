@@ -2,7 +2,7 @@ module manala
 
 require (
 	github.com/BurntSushi/toml v0.3.1 // indirect
-	github.com/Masterminds/semver v1.4.2 // indirect
+	github.com/Masterminds/semver v1.4.2
 	github.com/Masterminds/sprig v2.17.1+incompatible
 	github.com/alecthomas/gometalinter v3.0.0+incompatible // indirect
 	github.com/aokoli/goutils v1.1.0 // indirect
@@ -31,6 +31,7 @@ require (
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/spf13/afero v1.2.1
 	github.com/spf13/cobra v0.0.3
+	github.com/spf13/pflag v1.0.3
 	github.com/spf13/viper v1.3.1
 	github.com/stretchr/testify v1.3.0
 	golang.org/x/crypto v0.0.0-20190131182504-b8fe1690c613 // indirect
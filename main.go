@@ -11,12 +11,16 @@ import (
 	"github.com/spf13/viper"
 	"manala/cmd"
 	"manala/pkg/config"
+	"manala/pkg/hook"
+	"manala/pkg/migrator"
 	"manala/pkg/project"
 	"manala/pkg/repository"
 	"manala/pkg/syncer"
 	"manala/pkg/template"
 	"os"
 	"path"
+	"path/filepath"
+	"time"
 )
 
 // Set at build time, by goreleaser, via ldflags
@@ -24,9 +28,12 @@ var version = "dev"
 
 // Config
 var cfg = &config.Config{
-	Debug:      false,
-	CacheDir:   "",
-	Repository: "git@github.com:nervo/manala-templates.git",
+	Debug:       false,
+	CacheDir:    "",
+	Repository:  "git@github.com:nervo/manala-templates.git",
+	CacheTTL:    5 * time.Minute,
+	LockTimeout: 2 * time.Minute,
+	WalkSkip:    project.DefaultWalkSkip,
 }
 
 func main() {
@@ -42,8 +49,13 @@ Templates are pulled from git repository.`,
 	}
 
 	rootCmd.PersistentFlags().StringP("repository", "p", cfg.Repository, "repository")
+	rootCmd.PersistentFlags().StringSlice("repositories", cfg.Repositories, "repositories taking priority over default one, by order")
 	rootCmd.PersistentFlags().StringP("cache-dir", "c", cfg.CacheDir, "cache dir (default \"$HOME/.manala/cache\")")
 	rootCmd.PersistentFlags().BoolP("debug", "d", cfg.Debug, "debug")
+	rootCmd.PersistentFlags().Bool("offline", cfg.Offline, "use cached repositories, without reaching remotes")
+	rootCmd.PersistentFlags().Duration("cache-ttl", cfg.CacheTTL, "do not fetch cached repositories again within ttl")
+	rootCmd.PersistentFlags().Bool("refresh", cfg.Refresh, "force cached repositories fetch")
+	rootCmd.PersistentFlags().String("config", "", "config file (default \"$HOME/.config/manala/config.yaml\")")
 
 	// Container
 	container := goldi.NewContainer(goldi.NewTypeRegistry(), map[string]interface{}{})
@@ -53,70 +65,161 @@ Templates are pulled from git repository.`,
 	rootCmd.AddCommand(cmd.WatchCobra(container))
 	rootCmd.AddCommand(cmd.ListCobra(container))
 	rootCmd.AddCommand(cmd.InitCobra(container))
+	rootCmd.AddCommand(cmd.UpgradeCobra(container))
+	rootCmd.AddCommand(cmd.StatusCobra(container))
+	rootCmd.AddCommand(cmd.ShowCobra(container))
+	rootCmd.AddCommand(cmd.CacheCobra(container))
 
-	// Initialize
-	cobra.OnInitialize(func() {
+	// Initialize, once command and its arguments are known
+	rootCmd.PersistentPreRun = func(command *cobra.Command, args []string) {
 		// Logger
 		logger := &log.Logger{
 			Handler: cli.Default,
 			Level:   log.InfoLevel,
 		}
 
+		// Home dir
+		home, err := homedir.Dir()
+		if err != nil {
+			logger.WithError(err).Fatal("Error getting homedir")
+		}
+
+		// Ceiling dirs, as a path list, like git GIT_CEILING_DIRECTORIES
+		ceilingDirs := filepath.SplitList(os.Getenv("MANALA_CEILING_DIRECTORIES"))
+
 		// Viper
 		vpr := viper.New()
 		vpr.SetEnvPrefix("manala")
 		vpr.AutomaticEnv()
 		_ = vpr.BindPFlag("repository", rootCmd.PersistentFlags().Lookup("repository"))
+		_ = vpr.BindPFlag("repositories", rootCmd.PersistentFlags().Lookup("repositories"))
 		_ = vpr.BindPFlag("cache_dir", rootCmd.PersistentFlags().Lookup("cache-dir"))
 		_ = vpr.BindPFlag("debug", rootCmd.PersistentFlags().Lookup("debug"))
+		_ = vpr.BindPFlag("offline", rootCmd.PersistentFlags().Lookup("offline"))
+		_ = vpr.BindPFlag("cache_ttl", rootCmd.PersistentFlags().Lookup("cache-ttl"))
+		_ = vpr.BindPFlag("refresh", rootCmd.PersistentFlags().Lookup("refresh"))
+
+		// Config files
+		if file := rootCmd.PersistentFlags().Lookup("config").Value.String(); file != "" {
+			vpr.SetConfigFile(file)
+			if err := vpr.ReadInConfig(); err != nil {
+				logger.WithError(err).WithField("file", file).Fatal("Error reading config file")
+			}
+		} else {
+			// User global config file
+			if file := config.GlobalFile(home); fileExists(file) {
+				vpr.SetConfigFile(file)
+				if err := vpr.ReadInConfig(); err != nil {
+					logger.WithError(err).WithField("file", file).Fatal("Error reading config file")
+				}
+			}
+			// Project tree level config file, overriding user global one,
+			// searched from target dir up to the same limits as projects
+			dir := ""
+			if _, ok := command.Annotations[cmd.DirArgAnnotation]; ok && len(args) > 0 {
+				dir = args[0]
+			}
+			if dir, err := filepath.Abs(dir); err == nil {
+				localFile := ""
+				project.NewManager(afero.NewOsFs(), logger, project.Options{
+					CeilingDirs: append(vpr.GetStringSlice("ceiling_dirs"), ceilingDirs...),
+				}).Browse(dir, func(dir string) bool {
+					file, ok := config.LocalFile(dir)
+					localFile = file
+					return ok
+				})
+				if localFile != "" {
+					vpr.SetConfigFile(localFile)
+					if err := vpr.MergeInConfig(); err != nil {
+						logger.WithError(err).WithField("file", localFile).Fatal("Error reading config file")
+					}
+				}
+			}
+		}
 
 		// Config
-		err := vpr.Unmarshal(&cfg)
+		err = vpr.Unmarshal(&cfg)
 		if err != nil {
 			logger.WithError(err).Fatal("Error unmarshalling config")
 		}
 
+		// Git repositories authentications, decoded straight into repository manager ones
+		var repositoryAuths []repository.Auth
+		err = vpr.UnmarshalKey("auths", &repositoryAuths)
+		if err != nil {
+			logger.WithError(err).Fatal("Error unmarshalling config auths")
+		}
+
 		// Debug
 		if cfg.Debug {
 			logger.Level = log.DebugLevel
 		}
 
+		if file := vpr.ConfigFileUsed(); file != "" {
+			logger.WithField("file", file).Debug("Config file")
+		}
+
 		// Cache dir
 		if cfg.CacheDir == "" {
-			home, err := homedir.Dir()
-			if err != nil {
-				logger.WithError(err).Fatal("Error getting homedir")
-			}
 			cfg.CacheDir = path.Join(home, ".manala", "cache")
 		}
 
+		// Ceiling dirs
+		cfg.CeilingDirs = append(cfg.CeilingDirs, ceilingDirs...)
+
 		logger.WithField("repository", cfg.Repository).Debug("Config")
+		logger.WithField("repositories", cfg.Repositories).Debug("Config")
+		logger.WithField("aliases", cfg.Aliases).Debug("Config")
 		logger.WithField("cache_dir", cfg.CacheDir).Debug("Config")
 		logger.WithField("debug", cfg.Debug).Debug("Config")
+		logger.WithField("offline", cfg.Offline).Debug("Config")
+		logger.WithField("cache_ttl", cfg.CacheTTL).Debug("Config")
+		logger.WithField("refresh", cfg.Refresh).Debug("Config")
+		logger.WithField("lock_timeout", cfg.LockTimeout).Debug("Config")
+		logger.WithField("walk_skip", cfg.WalkSkip).Debug("Config")
+		logger.WithField("ceiling_dirs", cfg.CeilingDirs).Debug("Config")
+
+		// Repositories, by priority, builtin one as a fallback
+		repositorySrcs := append(append([]string{}, cfg.Repositories...), cfg.Repository, repository.BuiltinSrc)
 
 		// File System
 		fs := afero.NewOsFs()
 
+		// Repository manager, also resolving repositories aliases when filtering projects
+		repositoryManager := repository.NewManager(fs, logger, path.Join(cfg.CacheDir, "repository"), cfg.Debug, repository.Options{Aliases: cfg.Aliases, Offline: cfg.Offline, TTL: cfg.CacheTTL, Refresh: cfg.Refresh, Auths: repositoryAuths, LockTimeout: cfg.LockTimeout})
+
 		// Container
 		container.RegisterAll(map[string]goldi.TypeFactory{
 			"logger":             goldi.NewInstanceType(logger),
 			"fs":                 goldi.NewInstanceType(fs),
-			"project.manager":    goldi.NewType(project.NewManager, "@fs", "@logger"),
-			"repository.manager": goldi.NewType(repository.NewManager, "@fs", "@logger", path.Join(cfg.CacheDir, "repository"), cfg.Debug),
-			"template.manager":   goldi.NewType(template.NewSingleRepositoryManager, "@repository.manager", "@logger", cfg.Repository),
+			"project.manager":    goldi.NewType(project.NewManager, "@fs", "@logger", project.Options{WalkSkip: cfg.WalkSkip, CeilingDirs: cfg.CeilingDirs, Repositories: repositorySrcs, ResolveRepository: repositoryManager.Resolve}),
+			"repository.manager": goldi.NewInstanceType(repositoryManager),
+			"template.manager":   goldi.NewType(template.NewMultiRepositoryManager, "@repository.manager", "@logger", repositorySrcs),
 			"syncer":             goldi.NewType(syncer.New, "@logger"),
-			"cmd.update":         goldi.NewStructType(cmd.UpdateCmd{}, "@project.manager", "@template.manager", "@syncer", "@logger"),
+			"migrator":           goldi.NewType(migrator.New, "@project.manager", "@logger"),
+			"hook.runner":        goldi.NewType(hook.NewRunner, "@logger"),
+			"hook.trust_manager": goldi.NewType(hook.NewTrustManager, "@fs", "@logger", path.Join(home, ".manala", "trusted.yaml")),
+			"cmd.update":         goldi.NewStructType(cmd.UpdateCmd{}, "@project.manager", "@template.manager", "@syncer", "@migrator", "@hook.runner", "@hook.trust_manager", "@logger"),
+			"cmd.upgrade":        goldi.NewStructType(cmd.UpgradeCmd{}, "@project.manager", "@template.manager", "@syncer", "@migrator", "@hook.runner", "@hook.trust_manager", "@logger"),
+			"cmd.status":         goldi.NewStructType(cmd.StatusCmd{}, "@project.manager", "@template.manager", "@syncer", "@logger"),
 			"cmd.watch":          goldi.NewStructType(cmd.WatchCmd{}, "@project.manager", "@template.manager", "@syncer", "@logger"),
 			"cmd.list":           goldi.NewStructType(cmd.ListCmd{}, "@template.manager", "@logger"),
+			"cmd.show":           goldi.NewStructType(cmd.ShowCmd{}, "@template.manager", "@logger"),
+			"cmd.cache":          goldi.NewStructType(cmd.CacheCmd{}, "@repository.manager", "@project.manager", repositorySrcs, "@logger"),
 			"cmd.init":           goldi.NewStructType(cmd.InitCmd{}, "@project.manager", "@template.manager", "@syncer", "@logger"),
 		})
 
 		val := validation.NewContainerValidator()
 		val.MustValidate(container)
-	})
+	}
 
 	// Execute
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
+
+func fileExists(file string) bool {
+	info, err := os.Stat(file)
+	return err == nil && !info.IsDir()
+}
@@ -1,7 +1,58 @@
 package config
 
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
 type Config struct {
 	Debug      bool   `mapstructure:"debug"`
 	CacheDir   string `mapstructure:"cache_dir"`
 	Repository string `mapstructure:"repository"`
+	// Repositories taking priority over default one, by order
+	Repositories []string `mapstructure:"repositories"`
+	// Repositories sources, by alias name
+	Aliases map[string]string `mapstructure:"aliases"`
+	// Use cached repositories, without reaching remotes
+	Offline bool `mapstructure:"offline"`
+	// Cached repositories are not fetched again within ttl
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+	// Force cached repositories fetch
+	Refresh bool `mapstructure:"refresh"`
+	// Maximum time to wait for a cache repository locked by another process
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+	// Directories names never searched for projects, in recursive mode
+	WalkSkip []string `mapstructure:"walk_skip"`
+	// Directories whose parents are never searched for project
+	CeilingDirs []string `mapstructure:"ceiling_dirs"`
+}
+
+/*********/
+/* Files */
+/*********/
+
+const (
+	globalFile = "config.yaml"
+	localFile  = ".manala.config.yaml"
+)
+
+// Get user global config file, honouring XDG base directory specification
+func GlobalFile(home string) string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "manala", globalFile)
+}
+
+// Get local config file in dir, if any
+func LocalFile(dir string) (string, bool) {
+	file := filepath.Join(dir, localFile)
+	if info, err := os.Stat(file); err != nil || info.IsDir() {
+		return "", false
+	}
+
+	return file, true
 }
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_GlobalFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		xdgConfigHome string
+		want          string
+	}{
+		{"home", "", "/home/.config/manala/config.yaml"},
+		{"xdg_config_home", "/xdg", "/xdg/manala/config.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", tt.xdgConfigHome)
+			assert.Equal(t, tt.want, GlobalFile("/home"))
+		})
+	}
+}
+
+func Test_LocalFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		dir       string
+		want      string
+		wantFound bool
+	}{
+		{"local", "testdata/local", "testdata/local/.manala.config.yaml", true},
+		{"local_sub_dir", "testdata/local/foo", "", false},
+		{"local_dir", "testdata/local_dir", "", false},
+		{"local_not_found", "testdata/local_not_found", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, found := LocalFile(tt.dir)
+			assert.Equal(t, tt.wantFound, found)
+			assert.Equal(t, tt.want, file)
+		})
+	}
+}
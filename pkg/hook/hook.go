@@ -0,0 +1,69 @@
+package hook
+
+import (
+	"github.com/apex/log"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+/**********/
+/* Runner */
+/**********/
+
+type RunnerInterface interface {
+	Run(dir string, commands []string) error
+}
+
+func NewRunner(logger log.Interface) *runner {
+	return &runner{
+		logger: logger,
+	}
+}
+
+type runner struct {
+	logger log.Interface
+}
+
+// Run commands one after another in dir, stopping at first failure
+func (rnr *runner) Run(dir string, commands []string) error {
+	for _, command := range commands {
+		rnr.logger.WithFields(log.Fields{
+			"dir":     dir,
+			"command": command,
+		}).Info("Running hook...")
+
+		cmd := shell(command)
+		cmd.Dir = dir
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return &CommandError{Command: command, Err: err}
+		}
+	}
+
+	return nil
+}
+
+func shell(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+
+	return exec.Command("sh", "-c", command)
+}
+
+/**********/
+/* Errors */
+/**********/
+
+type CommandError struct {
+	Command string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	return "hook \"" + e.Command + "\" failed: " + e.Err.Error()
+}
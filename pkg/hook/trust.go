@@ -0,0 +1,90 @@
+package hook
+
+import (
+	"github.com/apex/log"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+)
+
+/*****************/
+/* Trust Manager */
+/*****************/
+
+// Keep track of repositories whose templates hooks are allowed to run
+type TrustManagerInterface interface {
+	IsTrusted(src string) (bool, error)
+	Trust(src string) error
+}
+
+func NewTrustManager(fs afero.Fs, logger log.Interface, file string) *trustManager {
+	return &trustManager{
+		fs:     fs,
+		logger: logger,
+		file:   file,
+	}
+}
+
+type trustManager struct {
+	fs     afero.Fs
+	logger log.Interface
+	file   string
+}
+
+func (mgr *trustManager) IsTrusted(src string) (bool, error) {
+	srcs, err := mgr.load()
+	if err != nil {
+		return false, err
+	}
+
+	for _, trusted := range srcs {
+		if trusted == src {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (mgr *trustManager) Trust(src string) error {
+	trusted, err := mgr.IsTrusted(src)
+	if err != nil || trusted {
+		return err
+	}
+
+	srcs, err := mgr.load()
+	if err != nil {
+		return err
+	}
+
+	content, err := yaml.Marshal(append(srcs, src))
+	if err != nil {
+		return err
+	}
+
+	if err := mgr.fs.MkdirAll(filepath.Dir(mgr.file), 0755); err != nil {
+		return err
+	}
+
+	mgr.logger.WithField("repository", src).Debug("Trusting repository...")
+
+	return afero.WriteFile(mgr.fs, mgr.file, content, 0666)
+}
+
+func (mgr *trustManager) load() ([]string, error) {
+	content, err := afero.ReadFile(mgr.fs, mgr.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var srcs []string
+	if err := yaml.Unmarshal(content, &srcs); err != nil {
+		return nil, err
+	}
+
+	return srcs, nil
+}
@@ -0,0 +1,39 @@
+package hook
+
+import (
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_trustManager(t *testing.T) {
+	// File system
+	fs := afero.NewMemMapFs()
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+	// Manager
+	manager := NewTrustManager(
+		fs,
+		logger,
+		"/foo/trusted.yaml",
+	)
+
+	trusted, err := manager.IsTrusted("foo.git")
+	assert.Nil(t, err)
+	assert.False(t, trusted)
+
+	assert.Nil(t, manager.Trust("foo.git"))
+	assert.Nil(t, manager.Trust("bar.git"))
+	assert.Nil(t, manager.Trust("foo.git"))
+
+	trusted, err = manager.IsTrusted("foo.git")
+	assert.Nil(t, err)
+	assert.True(t, trusted)
+
+	content, _ := afero.ReadFile(fs, "/foo/trusted.yaml")
+	assert.Equal(t, "- foo.git\n- bar.git\n", string(content))
+}
@@ -0,0 +1,282 @@
+package migrator
+
+import (
+	"github.com/Masterminds/semver"
+	"github.com/apex/log"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+	"manala/pkg/project"
+	"manala/pkg/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/**********/
+/* Errors */
+/**********/
+
+type StepError struct {
+	Version string
+	Step    string
+	Reason  string
+}
+
+func (e *StepError) Error() string {
+	msg := "invalid migration " + e.Version + " step"
+	if e.Step != "" {
+		msg += " \"" + e.Step + "\""
+	}
+
+	return msg + ": " + e.Reason
+}
+
+/************/
+/* Migrator */
+/************/
+
+type Interface interface {
+	GetPendingMigrations(prj project.Interface, tmpl template.Interface) ([]template.Migration, error)
+	MigrateProject(prj project.Interface, tmpl template.Interface) (bool, error)
+}
+
+func New(projectManager project.ManagerInterface, logger log.Interface) *migrator {
+	return &migrator{
+		projectManager: projectManager,
+		logger:         logger,
+	}
+}
+
+type migrator struct {
+	projectManager project.ManagerInterface
+	logger         log.Interface
+}
+
+// Get, in order, template migrations between project locked version and template one, not yet applied
+func (mgr *migrator) GetPendingMigrations(prj project.Interface, tmpl template.Interface) ([]template.Migration, error) {
+	lock, err := mgr.projectManager.GetLock(prj)
+	if err != nil {
+		return nil, err
+	}
+
+	return mgr.pendingMigrations(lock, tmpl)
+}
+
+func (mgr *migrator) pendingMigrations(lock *project.Lock, tmpl template.Interface) ([]template.Migration, error) {
+	// Unversioned template
+	if tmpl.GetVersion() == "" {
+		return nil, nil
+	}
+
+	target, err := semver.NewVersion(tmpl.GetVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	// Project has never been locked, as initialized or updated before locks existed;
+	// consider it at template version, with no migration pending
+	if lock.Version == "" {
+		return nil, nil
+	}
+
+	locked, err := semver.NewVersion(lock.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	type pending struct {
+		version   *semver.Version
+		migration template.Migration
+	}
+	var pendings []pending
+	for _, migration := range tmpl.GetMigrations() {
+		version, err := semver.NewVersion(migration.Version)
+		if err != nil {
+			return nil, err
+		}
+		if version.GreaterThan(target) {
+			continue
+		}
+		if !version.GreaterThan(locked) {
+			continue
+		}
+		if lock.HasMigration(migration.Version) {
+			continue
+		}
+		pendings = append(pendings, pending{version, migration})
+	}
+
+	sort.SliceStable(pendings, func(i, j int) bool {
+		return pendings[i].version.LessThan(pendings[j].version)
+	})
+
+	var migrations []template.Migration
+	for _, pending := range pendings {
+		migrations = append(migrations, pending.migration)
+	}
+
+	return migrations, nil
+}
+
+// Apply, in order, pending template migrations.
+// Each applied migration is recorded into project lock, so that it never runs twice.
+func (mgr *migrator) MigrateProject(prj project.Interface, tmpl template.Interface) (bool, error) {
+	lock, err := mgr.projectManager.GetLock(prj)
+	if err != nil {
+		return false, err
+	}
+
+	migrations, err := mgr.pendingMigrations(lock, tmpl)
+	if err != nil {
+		return false, err
+	}
+
+	for _, migration := range migrations {
+		mgr.logger.WithField("version", migration.Version).Info("Migrating project...")
+
+		for _, step := range migration.Steps {
+			if err := mgr.migrateStep(prj, migration.Version, step); err != nil {
+				return false, err
+			}
+		}
+
+		// Record progress
+		lock.Migrations = append(lock.Migrations, migration.Version)
+		if err := mgr.projectManager.SaveLock(prj, lock); err != nil {
+			return false, err
+		}
+
+		mgr.logger.WithField("version", migration.Version).Info("Project migrated")
+	}
+
+	return len(migrations) > 0, nil
+}
+
+func (mgr *migrator) migrateStep(prj project.Interface, version string, step template.MigrationStep) error {
+	switch {
+	case step.RenameOption != nil:
+		pair := step.RenameOption
+		if pair.From == "" || pair.To == "" {
+			return &StepError{Version: version, Step: "rename_option", Reason: "both from and to are required"}
+		}
+		mgr.logger.WithFields(log.Fields{"from": pair.From, "to": pair.To}).Debug("Renaming option...")
+		// Option could be missing, leaving config untouched
+		_, err := mgr.projectManager.RewriteConfig(prj, func(cfg yaml.MapSlice) (yaml.MapSlice, bool) {
+			value, ok := getOption(cfg, pair.From)
+			if !ok {
+				return cfg, false
+			}
+			cfg, _ = deleteOption(cfg, pair.From)
+			return setOption(cfg, pair.To, value), true
+		})
+		return err
+	case step.DeleteOption != "":
+		mgr.logger.WithField("option", step.DeleteOption).Debug("Deleting option...")
+		_, err := mgr.projectManager.RewriteConfig(prj, func(cfg yaml.MapSlice) (yaml.MapSlice, bool) {
+			return deleteOption(cfg, step.DeleteOption)
+		})
+		return err
+	case step.Move != nil:
+		pair := step.Move
+		if pair.From == "" || pair.To == "" {
+			return &StepError{Version: version, Step: "move", Reason: "both from and to are required"}
+		}
+		mgr.logger.WithFields(log.Fields{"from": pair.From, "to": pair.To}).Debug("Moving file...")
+		return move(prj.GetFs(), pair.From, pair.To)
+	case step.Delete != "":
+		mgr.logger.WithField("file", step.Delete).Debug("Deleting file...")
+		return prj.GetFs().RemoveAll(step.Delete)
+	}
+
+	return &StepError{Version: version, Reason: "no operation"}
+}
+
+// Move src to dst, if src exists, overwriting dst
+func move(fs afero.Fs, src string, dst string) error {
+	if _, err := fs.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if err := fs.RemoveAll(dst); err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(dst); dir != "." {
+		if err := fs.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	return fs.Rename(src, dst)
+}
+
+/***********/
+/* Options */
+/***********/
+
+// Options keys are dot separated paths into config nested maps
+
+func getOption(cfg yaml.MapSlice, key string) (interface{}, bool) {
+	keys := strings.SplitN(key, ".", 2)
+	for _, item := range cfg {
+		if item.Key != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			return item.Value, true
+		}
+		if sub, ok := item.Value.(yaml.MapSlice); ok {
+			return getOption(sub, keys[1])
+		}
+		return nil, false
+	}
+
+	return nil, false
+}
+
+func setOption(cfg yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	keys := strings.SplitN(key, ".", 2)
+	for i, item := range cfg {
+		if item.Key != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			cfg[i].Value = value
+		} else {
+			sub, _ := item.Value.(yaml.MapSlice)
+			cfg[i].Value = setOption(sub, keys[1], value)
+		}
+		return cfg
+	}
+
+	if len(keys) == 1 {
+		return append(cfg, yaml.MapItem{Key: keys[0], Value: value})
+	}
+
+	return append(cfg, yaml.MapItem{Key: keys[0], Value: setOption(nil, keys[1], value)})
+}
+
+func deleteOption(cfg yaml.MapSlice, key string) (yaml.MapSlice, bool) {
+	keys := strings.SplitN(key, ".", 2)
+	for i, item := range cfg {
+		if item.Key != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			return append(cfg[:i], cfg[i+1:]...), true
+		}
+		sub, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return cfg, false
+		}
+		sub, deleted := deleteOption(sub, keys[1])
+		cfg[i].Value = sub
+		return cfg, deleted
+	}
+
+	return cfg, false
+}
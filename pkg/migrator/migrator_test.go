@@ -0,0 +1,172 @@
+package migrator
+
+import (
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"manala/pkg/project"
+	"manala/pkg/template"
+	"testing"
+)
+
+type tmpl struct {
+	template.Interface
+	version    string
+	migrations []template.Migration
+}
+
+func (tmpl *tmpl) GetVersion() string {
+	return tmpl.version
+}
+
+func (tmpl *tmpl) GetMigrations() []template.Migration {
+	return tmpl.migrations
+}
+
+func Test_migrator_MigrateProject(t *testing.T) {
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	migrations := []template.Migration{
+		{Version: "1.2.0", Steps: []template.MigrationStep{
+			{RenameOption: &template.MigrationPair{From: "foo.bar", To: "foo.baz"}},
+			{Move: &template.MigrationPair{From: "bar", To: "qux/bar baz"}},
+		}},
+		{Version: "1.1.0", Steps: []template.MigrationStep{
+			{DeleteOption: "qux"},
+			{Delete: "foo"},
+		}},
+		{Version: "2.0.0", Steps: []template.MigrationStep{
+			{Delete: "baz"},
+		}},
+	}
+
+	type want struct {
+		migrated   bool
+		config     string
+		files      map[string]bool
+		migrations []string
+	}
+	tests := []struct {
+		name    string
+		version string
+		lock    string
+		want    want
+	}{
+		{
+			"not_locked",
+			"1.2.0",
+			"",
+			want{
+				false,
+				"manala:\n  template: foo\nfoo:\n  bar: bar\nqux: foo\n",
+				map[string]bool{"foo": true, "bar": true, "qux/bar baz": false, "baz": true},
+				nil,
+			},
+		},
+		{
+			"locked",
+			"2.0.0",
+			"version: 1.1.0\n",
+			want{
+				true,
+				"manala:\n  template: foo\nfoo:\n  baz: bar\nqux: foo\n",
+				map[string]bool{"foo": true, "bar": false, "qux/bar baz": true, "baz": false},
+				[]string{"1.2.0", "2.0.0"},
+			},
+		},
+		{
+			"already_migrated",
+			"1.2.0",
+			"version: 1.1.0\nmigrations: [1.2.0]\n",
+			want{
+				false,
+				"manala:\n  template: foo\nfoo:\n  bar: bar\nqux: foo\n",
+				map[string]bool{"foo": true, "bar": true, "qux/bar baz": false, "baz": true},
+				[]string{"1.2.0"},
+			},
+		},
+		{
+			"unversioned",
+			"",
+			"",
+			want{
+				false,
+				"manala:\n  template: foo\nfoo:\n  bar: bar\nqux: foo\n",
+				map[string]bool{"foo": true, "bar": true, "qux/bar baz": false, "baz": true},
+				nil,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// File system
+			fs := afero.NewBasePathFs(afero.NewMemMapFs(), "/")
+			_ = afero.WriteFile(fs, ".manala.yaml", []byte("manala:\n  template: foo\nfoo:\n  bar: bar\nqux: foo\n"), 0666)
+			_ = afero.WriteFile(fs, "foo", []byte(""), 0666)
+			_ = afero.WriteFile(fs, "bar", []byte(""), 0666)
+			_ = afero.WriteFile(fs, "baz", []byte(""), 0666)
+			if tt.lock != "" {
+				_ = afero.WriteFile(fs, ".manala.lock", []byte(tt.lock), 0666)
+			}
+
+			projectManager := project.NewManager(fs, logger, project.Options{})
+			prj, _ := projectManager.Create(fs)
+
+			mgr := New(projectManager, logger)
+
+			migrated, err := mgr.MigrateProject(prj, &tmpl{version: tt.version, migrations: migrations})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want.migrated, migrated)
+
+			config, _ := afero.ReadFile(fs, ".manala.yaml")
+			assert.Equal(t, tt.want.config, string(config))
+
+			for file, exists := range tt.want.files {
+				ok, _ := afero.Exists(fs, file)
+				assert.Equal(t, exists, ok, file)
+			}
+
+			lock, _ := projectManager.GetLock(prj)
+			assert.Equal(t, tt.want.migrations, lock.Migrations)
+		})
+	}
+}
+
+func Test_migrator_MigrateProject_invalid(t *testing.T) {
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+	// File system
+	fs := afero.NewBasePathFs(afero.NewMemMapFs(), "/")
+	_ = afero.WriteFile(fs, ".manala.yaml", []byte("manala:\n  template: foo\n"), 0666)
+	_ = afero.WriteFile(fs, ".manala.lock", []byte("version: 1.0.0\n"), 0666)
+
+	projectManager := project.NewManager(fs, logger, project.Options{})
+	prj, _ := projectManager.Create(fs)
+
+	mgr := New(projectManager, logger)
+
+	tests := []struct {
+		name    string
+		step    template.MigrationStep
+		wantErr string
+	}{
+		{"move_missing_to", template.MigrationStep{Move: &template.MigrationPair{From: "foo"}}, "invalid migration 1.1.0 step \"move\": both from and to are required"},
+		{"rename_option_missing_from", template.MigrationStep{RenameOption: &template.MigrationPair{To: "foo"}}, "invalid migration 1.1.0 step \"rename_option\": both from and to are required"},
+		{"empty", template.MigrationStep{}, "invalid migration 1.1.0 step: no operation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mgr.MigrateProject(prj, &tmpl{version: "1.1.0", migrations: []template.Migration{
+				{Version: "1.1.0", Steps: []template.MigrationStep{tt.step}},
+			}})
+			assert.IsType(t, &StepError{}, err)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package project
+
+import (
+	"os"
+	"syscall"
+)
+
+// Get file device id, if known
+func fileDevice(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(stat.Dev), true
+}
@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package project
+
+import (
+	"os"
+)
+
+// Get file device id, unknown on windows
+func fileDevice(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
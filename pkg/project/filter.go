@@ -0,0 +1,92 @@
+package project
+
+import (
+	"path"
+	"strings"
+)
+
+/**********/
+/* Filter */
+/**********/
+
+// Walked projects filter, by globs, as in "foo/*".
+// Empty criteria match any project.
+type Filter struct {
+	// Project template globs, any of them matching
+	Templates []string
+	// Project repository glob, wildcards matching across separators, as in "*/foo.git".
+	// Repository aliases are matched by their source. Projects without their own repository
+	// match as soon as any of the prioritized default ones does, as the one actually
+	// serving their template depends on repositories availability at sync time.
+	Repository string
+	// Project path globs, relative to walked directory, any of them matching
+	Paths []string
+	// Path globs, relative to walked directory, excluding projects along with their sub directories
+	ExcludePaths []string
+}
+
+// Validate filter globs syntax
+func (filter Filter) Validate() error {
+	globs := append(append(append([]string{}, filter.Templates...), filter.Paths...), filter.ExcludePaths...)
+	if filter.Repository != "" {
+		globs = append(globs, filter.Repository)
+	}
+
+	for _, glob := range globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Match project, rel being its path relative to walked directory,
+// and repositories the resolved sources its template could be served from
+func (filter Filter) Match(prj Interface, rel string, repositories []string) bool {
+	if len(filter.Templates) > 0 && !matchAny(filter.Templates, prj.GetTemplate()) {
+		return false
+	}
+
+	if filter.Repository != "" && !matchAnySource(filter.Repository, repositories) {
+		return false
+	}
+
+	if len(filter.Paths) > 0 && !matchAny(filter.Paths, rel) {
+		return false
+	}
+
+	return !filter.Excludes(rel)
+}
+
+// Whether path, relative to walked directory, is excluded
+func (filter Filter) Excludes(rel string) bool {
+	return matchAny(filter.ExcludePaths, rel)
+}
+
+// Match repository source, separators being regular characters, so that wildcards match across them
+func matchSource(glob string, src string) bool {
+	ok, _ := path.Match(strings.ReplaceAll(glob, "/", "\x00"), strings.ReplaceAll(src, "/", "\x00"))
+
+	return ok
+}
+
+func matchAnySource(glob string, srcs []string) bool {
+	for _, src := range srcs {
+		if matchSource(glob, src) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAny(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
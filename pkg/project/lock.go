@@ -0,0 +1,29 @@
+package project
+
+/********/
+/* Lock */
+/********/
+
+const lockFile = ".manala.lock"
+
+// Lock records the state of a project as of its last update
+type Lock struct {
+	// Template version the project has been updated to
+	Version string `yaml:"version,omitempty"`
+	// Template repository commit the project has been updated from
+	Commit string `yaml:"commit,omitempty"`
+	// Synced files content checksums, by path
+	Files map[string]string `yaml:"files,omitempty"`
+	// Template migrations already applied to the project
+	Migrations []string `yaml:"migrations,omitempty"`
+}
+
+func (lock *Lock) HasMigration(version string) bool {
+	for _, migration := range lock.Migrations {
+		if migration == version {
+			return true
+		}
+	}
+
+	return false
+}
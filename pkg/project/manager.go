@@ -6,9 +6,12 @@ import (
 	"github.com/asaskevich/govalidator"
 	"github.com/spf13/afero"
 	"github.com/spf13/viper"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+	"gopkg.in/yaml.v2"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 )
 
 /**********/
@@ -18,8 +21,22 @@ import (
 var (
 	ErrNotFound = errors.New("project not found")
 	ErrConfig   = errors.New("project config invalid")
+	ErrLock     = errors.New("project lock invalid")
 )
 
+// Project not found, along with searched directories
+type NotFoundError struct {
+	Dirs []string
+}
+
+func (err *NotFoundError) Error() string {
+	return ErrNotFound.Error() + " in " + strings.Join(err.Dirs, ", ")
+}
+
+func (err *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
 /**********/
 /* Config */
 /**********/
@@ -64,19 +81,36 @@ type ManagerInterface interface {
 	Create(fs afero.Fs) (*project, error)
 	Get(dir string) (*ManagedProject, error)
 	Find(dir string) (*ManagedProject, error)
-	Walk(dir string, fn ManagerWalkFunc) error
+	Browse(dir string, fn func(dir string) bool) []string
+	Walk(dir string, opt WalkOptions, fn ManagerWalkFunc) error
+	GetLock(prj Interface) (*Lock, error)
+	SaveLock(prj Interface, lock *Lock) error
+	RewriteConfig(prj Interface, fn ConfigRewriteFunc) (bool, error)
+}
+
+type Options struct {
+	// Directories names never searched for projects, when walking
+	WalkSkip []string
+	// Directories whose parents are never searched for projects, when finding, like git GIT_CEILING_DIRECTORIES
+	CeilingDirs []string
+	// Repositories sources used by projects without their own, by priority, when filtering walked ones
+	Repositories []string
+	// Resolve repository source, which could be an alias name, when filtering walked ones
+	ResolveRepository func(src string) string
 }
 
-func NewManager(fs afero.Fs, logger log.Interface) *manager {
+func NewManager(fs afero.Fs, logger log.Interface, options Options) *manager {
 	return &manager{
-		fs:     fs,
-		logger: logger,
+		fs:      fs,
+		logger:  logger,
+		options: options,
 	}
 }
 
 type manager struct {
-	fs     afero.Fs
-	logger log.Interface
+	fs      afero.Fs
+	logger  log.Interface
+	options Options
 }
 
 func (mgr *manager) Create(fs afero.Fs) (*project, error) {
@@ -150,47 +184,348 @@ func (mgr *manager) Get(dir string) (*ManagedProject, error) {
 	return nil, ErrNotFound
 }
 
-// Find a project by browsing dir then its parents up to root
+// Find a project by browsing dir then its parents, up to the enclosing git repository root,
+// a filesystem mount boundary, or a ceiling directory
 func (mgr *manager) Find(dir string) (*ManagedProject, error) {
-	// Todo: oh god... this algorithm sucks... how the hell git do ?
-	lastDir := ""
-	for dir != lastDir {
-		lastDir = dir
+	var prj *ManagedProject
+
+	dirs := mgr.Browse(dir, func(dir string) bool {
 		mgr.logger.WithField("dir", dir).Debug("Searching project...")
-		prj, err := mgr.Get(dir)
-		if err == nil {
-			return prj, nil
+
+		if mgr.hasConfig(dir) {
+			if found, err := mgr.Get(dir); err == nil {
+				prj = found
+				return true
+			}
 		}
-		dir = filepath.Dir(dir)
+
+		return false
+	})
+
+	if prj != nil {
+		return prj, nil
 	}
 
-	return nil, ErrNotFound
+	return nil, &NotFoundError{Dirs: dirs}
+}
+
+// Browse dir then its parents, until fn is satisfied, or a git repository root, a ceiling directory,
+// or a filesystem boundary is reached. Returns browsed dirs.
+func (mgr *manager) Browse(dir string, fn func(dir string) bool) []string {
+	var dirs []string
+
+	for {
+		logger := mgr.logger.WithField("dir", dir)
+
+		dirs = append(dirs, dir)
+
+		if fn(dir) {
+			break
+		}
+
+		if mgr.isGitRoot(dir) {
+			logger.Debug("Git repository root reached")
+			break
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+
+		if mgr.isCeilingDir(parent) {
+			logger.Debug("Ceiling directory reached")
+			break
+		}
+
+		if mgr.isMountBoundary(dir, parent) {
+			logger.Debug("Filesystem boundary reached")
+			break
+		}
+
+		dir = parent
+	}
+
+	return dirs
+}
+
+// Check dir is a git repository root, or a git worktree/submodule one, where .git is a file
+func (mgr *manager) isGitRoot(dir string) bool {
+	_, err := mgr.fs.Stat(path.Join(dir, ".git"))
+
+	return err == nil
+}
+
+func (mgr *manager) isCeilingDir(dir string) bool {
+	for _, ceilingDir := range mgr.options.CeilingDirs {
+		if ceilingDir != "" && filepath.Clean(ceilingDir) == filepath.Clean(dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check dir and its parent stand on different devices, if known
+func (mgr *manager) isMountBoundary(dir string, parent string) bool {
+	info, err := mgr.fs.Stat(dir)
+	if err != nil {
+		return false
+	}
+
+	parentInfo, err := mgr.fs.Stat(parent)
+	if err != nil {
+		return false
+	}
+
+	device, ok := fileDevice(info)
+	if !ok {
+		return false
+	}
+
+	parentDevice, ok := fileDevice(parentInfo)
+	if !ok {
+		return false
+	}
+
+	return device != parentDevice
 }
 
 type ManagerWalkFunc func(project *ManagedProject)
 
+// Directories names never searched for projects, by default
+var DefaultWalkSkip = []string{".git", "node_modules", "vendor"}
+
+// Files listing directories not searched for projects, in gitignore format
+var walkIgnoreFiles = []string{".gitignore", ".manalaignore"}
+
+type WalkOptions struct {
+	// Maximum depth of directories searched below dir, unlimited if zero
+	MaxDepth int
+	// Search for projects nested into found ones
+	Nested bool
+	// Only projects matching filter are walked
+	Filter Filter
+}
+
 // Find projects recursively starting from dir
-func (mgr *manager) Walk(dir string, fn ManagerWalkFunc) error {
+func (mgr *manager) Walk(dir string, opt WalkOptions, fn ManagerWalkFunc) error {
+	if err := opt.Filter.Validate(); err != nil {
+		return err
+	}
+
+	info, err := mgr.fs.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return &os.PathError{Op: "walk", Path: dir, Err: errors.New("not a directory")}
+	}
 
-	err := afero.Walk(mgr.fs, dir, func(path string, info os.FileInfo, err error) error {
-		if !info.IsDir() {
-			return nil
+	mgr.walk(dir, nil, nil, opt, fn)
+
+	return nil
+}
+
+// Get resolved repositories sources project template could be served from
+func (mgr *manager) repositories(prj Interface) []string {
+	srcs := mgr.options.Repositories
+	if prj.GetRepository() != "" {
+		srcs = []string{prj.GetRepository()}
+	}
+
+	if mgr.options.ResolveRepository == nil {
+		return srcs
+	}
+
+	resolved := make([]string, len(srcs))
+	for i, src := range srcs {
+		resolved[i] = mgr.options.ResolveRepository(src)
+	}
+
+	return resolved
+}
+
+// Search dir for a project, then its sub directories, rel being dir path components relative to walked one
+func (mgr *manager) walk(dir string, rel []string, patterns []gitignore.Pattern, opt WalkOptions, fn ManagerWalkFunc) {
+	logger := mgr.logger.WithField("dir", dir)
+
+	logger.Debug("Searching project...")
+	if mgr.hasConfig(dir) {
+		prj, err := mgr.Get(dir)
+		if err == nil {
+			if opt.Filter.Match(prj, relPath(rel), mgr.repositories(prj)) {
+				fn(prj)
+			} else {
+				logger.Debug("Project filtered out")
+			}
+
+			if !opt.Nested {
+				return
+			}
+		}
+	}
+
+	if opt.MaxDepth > 0 && len(rel) >= opt.MaxDepth {
+		return
+	}
+
+	files, err := afero.ReadDir(mgr.fs, dir)
+	if err != nil {
+		logger.WithError(err).Warn("Unable to read directory, skipping")
+		return
+	}
+
+	// Ignore patterns only apply to dir and its sub directories
+	patterns = append(patterns[:len(patterns):len(patterns)], mgr.readIgnorePatterns(dir, rel)...)
+	matcher := gitignore.NewMatcher(patterns)
+
+	for _, file := range files {
+		if !file.IsDir() || mgr.isWalkSkipped(file.Name()) {
+			continue
+		}
+
+		fileRel := append(rel[:len(rel):len(rel)], file.Name())
+		if matcher.Match(fileRel, true) || opt.Filter.Excludes(relPath(fileRel)) {
+			logger.WithField("name", file.Name()).Debug("Ignoring directory")
+			continue
 		}
 
-		mgr.logger.WithField("dir", path).Debug("Searching project...")
-		prj, err := mgr.Get(path)
+		mgr.walk(path.Join(dir, file.Name()), fileRel, patterns, opt, fn)
+	}
+}
+
+// Get path from its components relative to walked directory
+func relPath(rel []string) string {
+	if len(rel) == 0 {
+		return "."
+	}
+
+	return path.Join(rel...)
+}
+
+func (mgr *manager) isWalkSkipped(name string) bool {
+	for _, skip := range mgr.options.WalkSkip {
+		if name == skip {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Read dir ignore files patterns, rel being dir path components relative to walked one
+func (mgr *manager) readIgnorePatterns(dir string, rel []string) []gitignore.Pattern {
+	var patterns []gitignore.Pattern
+
+	for _, file := range walkIgnoreFiles {
+		content, err := afero.ReadFile(mgr.fs, path.Join(dir, file))
 		if err != nil {
-			return nil
+			continue
 		}
 
-		fn(prj)
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimRight(line, "\r")
+			if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+				continue
+			}
+			patterns = append(patterns, gitignore.ParsePattern(line, rel))
+		}
+	}
 
-		return nil
-	})
+	return patterns
+}
 
+// Check dir holds a project config file, without loading it
+func (mgr *manager) hasConfig(dir string) bool {
+	for _, cfg := range supportedConfigNames {
+		if !cfg.required {
+			continue
+		}
+		for _, ext := range viper.SupportedExts {
+			if info, err := mgr.fs.Stat(path.Join(dir, cfg.name+"."+ext)); err == nil && !info.IsDir() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Get project lock, empty if project has never been locked
+func (mgr *manager) GetLock(prj Interface) (*Lock, error) {
+	lock := &Lock{}
+
+	content, err := afero.ReadFile(prj.GetFs(), lockFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lock, nil
+		}
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(content, lock); err != nil {
+		return nil, ErrLock
+	}
+
+	return lock, nil
+}
+
+// Save project lock
+func (mgr *manager) SaveLock(prj Interface, lock *Lock) error {
+	content, err := yaml.Marshal(lock)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return afero.WriteFile(prj.GetFs(), lockFile, content, 0666)
+}
+
+// Rewrite a project config, returning it along with whether it has been modified
+type ConfigRewriteFunc func(cfg yaml.MapSlice) (yaml.MapSlice, bool)
+
+// Rewrite project yaml config files, telling whether any has been modified.
+// Other config formats are left untouched.
+func (mgr *manager) RewriteConfig(prj Interface, fn ConfigRewriteFunc) (bool, error) {
+	rewritten := false
+
+	for _, cfg := range supportedConfigNames {
+		for _, ext := range []string{"yaml", "yml"} {
+			file := cfg.name + "." + ext
+
+			content, err := afero.ReadFile(prj.GetFs(), file)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return rewritten, err
+			}
+
+			var doc yaml.MapSlice
+			if err := yaml.Unmarshal(content, &doc); err != nil {
+				return rewritten, ErrConfig
+			}
+
+			doc, modified := fn(doc)
+			if !modified {
+				continue
+			}
+
+			mgr.logger.WithField("file", file).Debug("Rewriting project config...")
+
+			content, err = yaml.Marshal(doc)
+			if err != nil {
+				return rewritten, err
+			}
+
+			if err := afero.WriteFile(prj.GetFs(), file, content, 0666); err != nil {
+				return rewritten, err
+			}
+
+			rewritten = true
+		}
+	}
+
+	return rewritten, nil
 }
@@ -1,10 +1,14 @@
 package project
 
 import (
+	"errors"
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/discard"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path"
 	"testing"
 )
 
@@ -22,6 +26,7 @@ func Test_manager_Create(t *testing.T) {
 	manager := NewManager(
 		fs,
 		logger,
+		Options{},
 	)
 
 	type args struct {
@@ -30,6 +35,7 @@ func Test_manager_Create(t *testing.T) {
 	type want struct {
 		template   string
 		repository string
+		ref        string
 	}
 	tests := []struct {
 		name    string
@@ -55,6 +61,12 @@ func Test_manager_Create(t *testing.T) {
 			&want{template: "foo", repository: "foo.git"},
 			nil,
 		},
+		{
+			"project_ref",
+			args{fs: afero.NewBasePathFs(fs, "project_ref")},
+			&want{template: "foo", repository: "foo.git", ref: "v1.0.0"},
+			nil,
+		},
 		{
 			"project_not_found",
 			args{fs: afero.NewBasePathFs(fs, "project_not_found")},
@@ -82,6 +94,7 @@ func Test_manager_Create(t *testing.T) {
 			if tt.want != nil {
 				assert.Equal(t, tt.want.template, prj.GetTemplate())
 				assert.Equal(t, tt.want.repository, prj.GetRepository())
+				assert.Equal(t, tt.want.ref, prj.GetRef())
 			}
 		})
 	}
@@ -101,6 +114,7 @@ func Test_manager_Get(t *testing.T) {
 	manager := NewManager(
 		fs,
 		logger,
+		Options{},
 	)
 
 	type args struct {
@@ -156,6 +170,7 @@ func Test_manager_Find(t *testing.T) {
 	manager := NewManager(
 		fs,
 		logger,
+		Options{},
 	)
 
 	type args struct {
@@ -187,7 +202,7 @@ func Test_manager_Find(t *testing.T) {
 			"project_parent_not_found",
 			args{dir: "project_parent_not_found/foo"},
 			nil,
-			ErrNotFound,
+			&NotFoundError{},
 		},
 	}
 	for _, tt := range tests {
@@ -203,6 +218,48 @@ func Test_manager_Find(t *testing.T) {
 	}
 }
 
+func Test_manager_Find_boundaries(t *testing.T) {
+	// File system
+	fs := afero.NewMemMapFs()
+	_ = afero.WriteFile(fs, "/.manala.yaml", []byte("manala:\n  template: foo\n"), 0666)
+	_ = fs.MkdirAll("/repository/.git", 0755)
+	_ = fs.MkdirAll("/repository/foo/bar", 0755)
+	_ = fs.MkdirAll("/ceiling/foo/bar", 0755)
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+	// Manager
+	manager := NewManager(
+		fs,
+		logger,
+		Options{CeilingDirs: []string{"/ceiling/"}},
+	)
+
+	tests := []struct {
+		name     string
+		dir      string
+		wantDirs []string
+	}{
+		{"git_root", "/repository/foo/bar", []string{"/repository/foo/bar", "/repository/foo", "/repository"}},
+		{"ceiling", "/ceiling/foo/bar", []string{"/ceiling/foo/bar", "/ceiling/foo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prj, err := manager.Find(tt.dir)
+			assert.Nil(t, prj)
+			assert.True(t, errors.Is(err, ErrNotFound))
+			assert.Equal(t, &NotFoundError{Dirs: tt.wantDirs}, err)
+		})
+	}
+
+	t.Run("root", func(t *testing.T) {
+		prj, err := manager.Find("/foo")
+		assert.Nil(t, err)
+		assert.Equal(t, "foo", prj.GetTemplate())
+	})
+}
+
 func Test_manager_Walk(t *testing.T) {
 	// File system
 	fs := afero.NewBasePathFs(
@@ -217,40 +274,169 @@ func Test_manager_Walk(t *testing.T) {
 	manager := NewManager(
 		fs,
 		logger,
+		Options{
+			WalkSkip:     DefaultWalkSkip,
+			Repositories: []string{"first.git", "default.git"},
+			ResolveRepository: func(src string) string {
+				if src == "company" {
+					return "https://example.com/company.git"
+				}
+				return src
+			},
+		},
 	)
 
 	type args struct {
 		dir string
-	}
-	type want struct {
-		template   string
-		repository string
+		opt WalkOptions
 	}
 	tests := []struct {
 		name    string
 		args    args
-		want    []want
+		want    []string
 		wantErr error
 	}{
 		{
 			"projects",
 			args{dir: "/projects"},
-			[]want{
-				{template: "foo", repository: ""},
-				{template: "bar", repository: ""},
-				{template: "baz", repository: ""},
-			},
+			[]string{"foo"},
+			nil,
+		},
+		{
+			"projects_nested",
+			args{dir: "/projects", opt: WalkOptions{Nested: true}},
+			[]string{"foo", "bar", "baz"},
+			nil,
+		},
+		{
+			"projects_max_depth",
+			args{dir: "/projects", opt: WalkOptions{Nested: true, MaxDepth: 1}},
+			[]string{"foo", "bar"},
 			nil,
 		},
+		{
+			"walk",
+			args{dir: "/walk"},
+			[]string{"foo", "corge"},
+			nil,
+		},
+		{
+			"walk_nested",
+			args{dir: "/walk", opt: WalkOptions{Nested: true}},
+			[]string{"foo", "bar", "corge"},
+			nil,
+		},
+		{
+			"walk_filter_template",
+			args{dir: "/walk", opt: WalkOptions{Nested: true, Filter: Filter{Templates: []string{"ba*", "corge"}}}},
+			[]string{"bar", "corge"},
+			nil,
+		},
+		{
+			"walk_filter_path",
+			args{dir: "/walk", opt: WalkOptions{Nested: true, Filter: Filter{Paths: []string{"foo/*"}}}},
+			[]string{"bar"},
+			nil,
+		},
+		{
+			"walk_filter_exclude_path",
+			args{dir: "/walk", opt: WalkOptions{Nested: true, Filter: Filter{ExcludePaths: []string{"foo"}}}},
+			[]string{"corge"},
+			nil,
+		},
+		{
+			"walk_filter_repository",
+			args{dir: "/walk_repository", opt: WalkOptions{Filter: Filter{Repository: "*/foo.git"}}},
+			[]string{"foo"},
+			nil,
+		},
+		{
+			"walk_filter_repository_alias",
+			args{dir: "/walk_repository", opt: WalkOptions{Filter: Filter{Repository: "*/company.git"}}},
+			[]string{"qux"},
+			nil,
+		},
+		{
+			"walk_filter_repository_default",
+			args{dir: "/walk_repository", opt: WalkOptions{Filter: Filter{Repository: "default.git"}}},
+			[]string{"bar"},
+			nil,
+		},
+		{
+			"walk_filter_repository_default_priority",
+			args{dir: "/walk_repository", opt: WalkOptions{Filter: Filter{Repository: "first.git"}}},
+			[]string{"bar"},
+			nil,
+		},
+		{
+			"walk_filter_invalid",
+			args{dir: "/walk", opt: WalkOptions{Filter: Filter{Paths: []string{"["}}}},
+			[]string{},
+			path.ErrBadPattern,
+		},
+		{
+			"walk_not_found",
+			args{dir: "/walk_not_found"},
+			[]string{},
+			&os.PathError{},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := make([]want, 0)
-			err := manager.Walk(tt.args.dir, func(prj *ManagedProject) {
-				got = append(got, want{template: prj.GetTemplate(), repository: prj.GetRepository()})
+			got := make([]string, 0)
+			err := manager.Walk(tt.args.dir, tt.args.opt, func(prj *ManagedProject) {
+				got = append(got, prj.GetTemplate())
 			})
 			assert.IsType(t, tt.wantErr, err)
 			assert.Equal(t, tt.want, got)
 		})
 	}
 }
+
+func Test_manager_RewriteConfig(t *testing.T) {
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	// Set manala ref, if any manala map
+	fn := func(cfg yaml.MapSlice) (yaml.MapSlice, bool) {
+		for i, item := range cfg {
+			if manala, ok := item.Value.(yaml.MapSlice); ok && item.Key == "manala" {
+				cfg[i].Value = append(manala, yaml.MapItem{Key: "ref", Value: "v1.0.0"})
+				return cfg, true
+			}
+		}
+		return cfg, false
+	}
+
+	tests := []struct {
+		name        string
+		file        string
+		content     string
+		want        bool
+		wantContent string
+	}{
+		{"yaml", ".manala.yaml", "manala:\n  template: foo\n", true, "manala:\n  template: foo\n  ref: v1.0.0\n"},
+		{"yml", ".manala.yml", "manala:\n  template: foo\n", true, "manala:\n  template: foo\n  ref: v1.0.0\n"},
+		{"json", ".manala.json", `{"manala": {"template": "foo"}}`, false, `{"manala": {"template": "foo"}}`},
+		{"unmodified", ".manala.yaml", "manala: foo\n", false, "manala: foo\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// File system
+			fs := afero.NewBasePathFs(afero.NewMemMapFs(), "/")
+			_ = afero.WriteFile(fs, tt.file, []byte(tt.content), 0666)
+
+			mgr := NewManager(fs, logger, Options{})
+			prj := &project{fs: fs}
+
+			rewritten, err := mgr.RewriteConfig(prj, fn)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, rewritten)
+
+			content, _ := afero.ReadFile(fs, tt.file)
+			assert.Equal(t, tt.wantContent, string(content))
+		})
+	}
+}
@@ -12,12 +12,14 @@ type Interface interface {
 	GetFs() afero.Fs
 	GetTemplate() string
 	GetRepository() string
+	GetRef() string
 	GetOptions() map[string]interface{}
 }
 
 type Config struct {
 	Template   string `mapstructure:"template" valid:"required" yaml:"template"`
 	Repository string `mapstructure:"repository" yaml:"repository,omitempty"`
+	Ref        string `mapstructure:"ref" yaml:"ref,omitempty"`
 }
 
 type project struct {
@@ -38,6 +40,10 @@ func (prj *project) GetRepository() string {
 	return prj.config.Repository
 }
 
+func (prj *project) GetRef() string {
+	return prj.config.Ref
+}
+
 func (prj *project) GetOptions() map[string]interface{} {
 	return prj.options
 }
@@ -0,0 +1,448 @@
+package repository
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/spf13/afero"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+/**********/
+/* Errors */
+/**********/
+
+var (
+	ErrChecksum = errors.New("repository archive checksum mismatch")
+)
+
+/***********/
+/* Archive */
+/***********/
+
+var archiveExts = []string{".tar.gz", ".tgz", ".zip"}
+
+// Archive sources could be suffixed by a checksum query, as in "foo.tar.gz?checksum=sha256:abcd..."
+func isArchive(src string) bool {
+	location, _ := splitArchiveSource(src)
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(location, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Split archive source into its location and its checksum, if any
+func splitArchiveSource(src string) (string, string) {
+	i := strings.LastIndex(src, "?")
+	if i < 0 {
+		return src, ""
+	}
+
+	query, err := url.ParseQuery(src[i+1:])
+	if err != nil {
+		return src, ""
+	}
+
+	checksum := query.Get("checksum")
+	query.Del("checksum")
+
+	location := src[:i]
+	if len(query) > 0 {
+		location += "?" + query.Encode()
+	}
+
+	return location, checksum
+}
+
+func (mgr *manager) createArchive(src string, ref string) (*ManagedRepository, error) {
+	// Archives have no refs
+	if ref != "" {
+		return nil, ErrRefNotFound
+	}
+
+	hash := md5.New()
+	hash.Write([]byte(src))
+
+	// Repository cache directory should be unique
+	dir := path.Join(mgr.cacheDir, hex.EncodeToString(hash.Sum(nil)))
+
+	// Prevent concurrent processes from extracting the same cache
+	unlock, err := mgr.lock(dir)
+	if err != nil {
+		return nil, newError(src, err)
+	}
+	defer unlock()
+
+	md, err := mgr.readMetadata(dir)
+	if err != nil {
+		return nil, err
+	}
+	if md == nil {
+		md = &metadata{Src: src}
+	}
+
+	cached, _ := afero.DirExists(mgr.fs, dir)
+
+	switch {
+	case !cached && mgr.options.Offline:
+		return nil, newError(src, ErrNotCached)
+	case mgr.options.Offline:
+		mgr.logger.WithField("age", md.age()).Info("Offline, using cache repository")
+	case cached && mgr.isFresh(md):
+		mgr.logger.WithField("age", md.age()).Debug("Cache repository fresh, skipping fetch")
+	default:
+		err := mgr.fetchArchive(src, dir, md, cached)
+
+		switch {
+		case err == nil:
+			md.LastFetch = time.Now()
+		case cached && isUnreachable(err):
+			// Fallback on cache
+			mgr.logger.WithError(err).WithField("age", md.age()).Warn("Repository unreachable, using cache repository")
+		default:
+			return nil, newError(src, err)
+		}
+	}
+
+	md.LastUse = time.Now()
+	if err := mgr.writeMetadata(dir, md); err != nil {
+		return nil, err
+	}
+
+	return &ManagedRepository{
+		Interface: &repository{
+			src: src,
+			fs:  afero.NewBasePathFs(mgr.fs, dir),
+		},
+		dir: dir,
+	}, nil
+}
+
+// Fetch archive, from a local path or an http url, and extract it into dir, unless not modified since cached
+func (mgr *manager) fetchArchive(src string, dir string, md *metadata, cached bool) error {
+	location, checksum := splitArchiveSource(src)
+
+	var file afero.File
+	var err error
+
+	download := strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+
+	if download {
+		file, err = mgr.downloadArchive(location, md, cached)
+	} else {
+		file, err = mgr.openArchive(location, md, cached)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Not modified
+	if file == nil {
+		mgr.logger.Debug("Cache repository archive not modified")
+		return nil
+	}
+
+	if download {
+		defer mgr.fs.Remove(file.Name())
+	}
+	defer file.Close()
+
+	if checksum != "" {
+		if err := verifyChecksum(file, checksum); err != nil {
+			return err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	return mgr.extractArchive(location, file, dir)
+}
+
+// Archives downloads should never hang forever
+var archiveHttpClient = &http.Client{Timeout: 10 * time.Minute}
+
+// Download archive into a temporary file, conditionally on its etag or last modification date.
+// Returns nil file if not modified.
+func (mgr *manager) downloadArchive(location string, md *metadata, cached bool) (afero.File, error) {
+	mgr.logger.WithField("url", location).Debug("Downloading repository archive...")
+
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint, err := transport.NewEndpoint(location); err == nil {
+		if auth := mgr.findAuth(location, endpoint); auth != nil {
+			switch {
+			case auth.Token != "":
+				username := os.ExpandEnv(auth.Username)
+				if username == "" {
+					username = "token"
+				}
+				req.SetBasicAuth(username, os.ExpandEnv(auth.Token))
+			case auth.Username != "":
+				req.SetBasicAuth(os.ExpandEnv(auth.Username), os.ExpandEnv(auth.Password))
+			}
+		}
+	}
+
+	if cached {
+		if md.ETag != "" {
+			req.Header.Set("If-None-Match", md.ETag)
+		}
+		if md.LastModified != "" {
+			req.Header.Set("If-Modified-Since", md.LastModified)
+		}
+	}
+
+	resp, err := archiveHttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusNotFound:
+		return nil, transport.ErrRepositoryNotFound
+	case http.StatusUnauthorized:
+		return nil, transport.ErrAuthenticationRequired
+	case http.StatusForbidden:
+		return nil, transport.ErrAuthorizationFailed
+	default:
+		return nil, fmt.Errorf("unexpected http status: %s", resp.Status)
+	}
+
+	if err := mgr.fs.MkdirAll(mgr.cacheDir, 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := afero.TempFile(mgr.fs, mgr.cacheDir, ".download-")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.Copy(file, resp.Body)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		mgr.fs.Remove(file.Name())
+		return nil, err
+	}
+
+	md.ETag = resp.Header.Get("ETag")
+	md.LastModified = resp.Header.Get("Last-Modified")
+
+	return file, nil
+}
+
+// Open local archive, conditionally on its last modification date.
+// Returns nil file if not modified.
+func (mgr *manager) openArchive(location string, md *metadata, cached bool) (afero.File, error) {
+	mgr.logger.WithField("file", location).Debug("Reading repository archive...")
+
+	info, err := mgr.fs.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+
+	modified := info.ModTime().UTC().Format(http.TimeFormat)
+	if cached && md.LastModified == modified {
+		return nil, nil
+	}
+
+	file, err := mgr.fs.Open(location)
+	if err != nil {
+		return nil, err
+	}
+
+	md.LastModified = modified
+
+	return file, nil
+}
+
+// Verify content against checksum, as in "sha256:abcd..."
+func verifyChecksum(content io.Reader, checksum string) error {
+	i := strings.Index(checksum, ":")
+	if i < 0 {
+		return fmt.Errorf("invalid checksum: %s", checksum)
+	}
+
+	var hash hash.Hash
+	switch checksum[:i] {
+	case "md5":
+		hash = md5.New()
+	case "sha1":
+		hash = sha1.New()
+	case "sha256":
+		hash = sha256.New()
+	case "sha512":
+		hash = sha512.New()
+	default:
+		return fmt.Errorf("unsupported checksum type: %s", checksum[:i])
+	}
+
+	if _, err := io.Copy(hash, content); err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), checksum[i+1:]) {
+		return ErrChecksum
+	}
+
+	return nil
+}
+
+// Extract archive content atomically, into a temporary directory then renamed to dir.
+// A single top level directory, as found in most release archives, is stripped, unless it is a template itself.
+func (mgr *manager) extractArchive(location string, file afero.File, dir string) error {
+	if err := mgr.fs.MkdirAll(mgr.cacheDir, 0755); err != nil {
+		return err
+	}
+
+	tmpDir, err := afero.TempDir(mgr.fs, mgr.cacheDir, ".extract-")
+	if err != nil {
+		return err
+	}
+	defer mgr.fs.RemoveAll(tmpDir)
+
+	mgr.logger.WithField("dir", tmpDir).Debug("Extracting repository archive...")
+
+	if strings.HasSuffix(location, ".zip") {
+		err = mgr.extractZip(file, tmpDir)
+	} else {
+		err = mgr.extractTarGz(file, tmpDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	root := tmpDir
+	if files, err := afero.ReadDir(mgr.fs, tmpDir); err == nil && len(files) == 1 && files[0].IsDir() {
+		if ok, _ := afero.Exists(mgr.fs, path.Join(tmpDir, files[0].Name(), ".manala.yaml")); !ok {
+			root = path.Join(tmpDir, files[0].Name())
+		}
+	}
+
+	if err := mgr.fs.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	return mgr.fs.Rename(root, dir)
+}
+
+func (mgr *manager) extractTarGz(file afero.File, dir string) error {
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := mgr.extractDir(dir, header.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := mgr.extractFile(dir, header.Name, os.FileMode(header.Mode), tarReader); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (mgr *manager) extractZip(file afero.File, dir string) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	zipReader, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			if err := mgr.extractDir(dir, file.Name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		err = mgr.extractFile(dir, file.Name, file.Mode(), reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get archive entry path into dir, ensuring it never escapes it
+func archivePath(dir string, name string) string {
+	return path.Join(dir, path.Clean("/"+strings.ReplaceAll(name, "\\", "/")))
+}
+
+func (mgr *manager) extractDir(dir string, name string) error {
+	return mgr.fs.MkdirAll(archivePath(dir, name), 0755)
+}
+
+func (mgr *manager) extractFile(dir string, name string, mode os.FileMode, reader io.Reader) error {
+	file := archivePath(dir, name)
+
+	if err := mgr.fs.MkdirAll(path.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	dst, err := mgr.fs.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, reader)
+
+	return err
+}
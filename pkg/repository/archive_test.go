@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tarGzArchive(files map[string]string) []byte {
+	buffer := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		_ = tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		_, _ = tarWriter.Write([]byte(content))
+	}
+	_ = tarWriter.Close()
+	_ = gzipWriter.Close()
+
+	return buffer.Bytes()
+}
+
+func zipArchive(files map[string]string) []byte {
+	buffer := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buffer)
+	for name, content := range files {
+		writer, _ := zipWriter.Create(name)
+		_, _ = writer.Write([]byte(content))
+	}
+	_ = zipWriter.Close()
+
+	return buffer.Bytes()
+}
+
+func Test_manager_createArchive(t *testing.T) {
+	// Cache
+	dir, _ := ioutil.TempDir("", "manala")
+	defer os.RemoveAll(dir)
+	// File system
+	fs := afero.NewOsFs()
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	archive := tarGzArchive(map[string]string{
+		"templates-1.0.0/foo/.manala.yaml": "manala: {}",
+	})
+	sum := sha256.Sum256(archive)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	// Server
+	var hits, modified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/templates.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		hits++
+		w.Header().Set("ETag", `"foo"`)
+		if r.Header.Get("If-None-Match") == `"foo"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		modified++
+		_, _ = w.Write(archive)
+	}))
+	defer server.Close()
+
+	mgr := NewManager(fs, logger, dir, false, Options{})
+
+	t.Run("http", func(t *testing.T) {
+		rep, err := mgr.Create(server.URL+"/templates.tar.gz?checksum="+checksum, "")
+		assert.Nil(t, err)
+		assert.Equal(t, "templates", rep.GetName())
+		content, _ := afero.ReadFile(rep.GetFs(), "foo/.manala.yaml")
+		assert.Equal(t, "manala: {}", string(content))
+
+		// Not modified
+		rep, err = mgr.Create(server.URL+"/templates.tar.gz?checksum="+checksum, "")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, hits)
+		assert.Equal(t, 1, modified)
+		exists, _ := afero.Exists(rep.GetFs(), "foo/.manala.yaml")
+		assert.True(t, exists)
+
+		// Downloaded archive is not kept
+		files, _ := filepath.Glob(filepath.Join(dir, ".download-*"))
+		assert.Empty(t, files)
+	})
+
+	t.Run("http_checksum_mismatch", func(t *testing.T) {
+		_, err := mgr.Create(server.URL+"/templates.tar.gz?checksum=sha256:0000", "")
+		assert.True(t, errors.Is(err, ErrChecksum))
+	})
+
+	t.Run("http_not_found", func(t *testing.T) {
+		_, err := mgr.Create(server.URL+"/missing.tar.gz", "")
+		assert.IsType(t, &Error{}, err)
+		assert.Equal(t, ErrorNotFound, err.(*Error).Kind)
+	})
+
+	t.Run("local_zip", func(t *testing.T) {
+		file := filepath.Join(dir, "templates.zip")
+		_ = ioutil.WriteFile(file, zipArchive(map[string]string{
+			"foo/.manala.yaml": "manala: {}",
+			"bar/.manala.yaml": "manala: {}",
+		}), 0644)
+
+		rep, err := mgr.Create(file, "")
+		assert.Nil(t, err)
+		files, _ := afero.ReadDir(rep.GetFs(), "")
+		assert.Len(t, files, 2)
+	})
+
+	t.Run("local_single_template", func(t *testing.T) {
+		file := filepath.Join(dir, "template.tar.gz")
+		_ = ioutil.WriteFile(file, tarGzArchive(map[string]string{
+			"foo/.manala.yaml": "manala: {}",
+		}), 0644)
+
+		// Single top level directory is kept, as a template
+		rep, err := mgr.Create(file, "")
+		assert.Nil(t, err)
+		exists, _ := afero.Exists(rep.GetFs(), "foo/.manala.yaml")
+		assert.True(t, exists)
+	})
+
+	t.Run("ref", func(t *testing.T) {
+		_, err := mgr.Create(server.URL+"/templates.tar.gz", "v1.0.0")
+		assert.Equal(t, ErrRefNotFound, err)
+	})
+}
@@ -0,0 +1,47 @@
+// Templates embedded in manala binary, so that it works out of the box,
+// even without access to any remote repository.
+package builtin
+
+import (
+	"embed"
+	"github.com/spf13/afero"
+	"io/fs"
+	"path"
+)
+
+// Embedded templates, dot files being explicitly matched
+//
+//go:embed templates templates/*/.*
+var files embed.FS
+
+const root = "templates"
+
+// Get a read-only file system over embedded templates
+func Fs() (afero.Fs, error) {
+	memFs := afero.NewMemMapFs()
+
+	err := fs.WalkDir(files, root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		dst := path.Join("/", file[len(root):])
+
+		if entry.IsDir() {
+			return memFs.MkdirAll(dst, 0755)
+		}
+
+		content, err := files.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		return afero.WriteFile(memFs, dst, content, 0644)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Memory file system handles absolute paths only
+	return afero.NewBasePathFs(afero.NewReadOnlyFs(memFs), "/"), nil
+}
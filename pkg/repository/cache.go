@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"github.com/spf13/afero"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+/*********************/
+/* Cached Repository */
+/*********************/
+
+type CachedRepository struct {
+	Dir string
+	// Source and ref are empty for caches predating metadata
+	Src       string
+	Ref       string
+	LastFetch time.Time
+	LastUse   time.Time
+	Size      int64
+}
+
+/*********/
+/* Cache */
+/*********/
+
+// List cached repositories
+func (mgr *manager) ListCache() ([]*CachedRepository, error) {
+	files, err := afero.ReadDir(mgr.fs, mgr.cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var caches []*CachedRepository
+
+	for _, file := range files {
+		// Exclude non directories, and temporary ones
+		if !file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		dir := path.Join(mgr.cacheDir, file.Name())
+
+		cached := &CachedRepository{Dir: dir}
+
+		md, err := mgr.readMetadata(dir)
+		if err != nil {
+			return nil, err
+		}
+		if md != nil {
+			cached.Src = md.Src
+			cached.Ref = md.Ref
+			cached.LastFetch = md.LastFetch
+			cached.LastUse = md.LastUse
+		}
+
+		err = afero.Walk(mgr.fs, dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				cached.Size += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		caches = append(caches, cached)
+	}
+
+	return caches, nil
+}
+
+// Remove cached repository, along with its metadata.
+// Lock file is kept, as another process could be waiting on it.
+func (mgr *manager) RemoveCache(cached *CachedRepository) error {
+	mgr.logger.WithField("dir", cached.Dir).Debug("Removing cache repository...")
+
+	// Prevent removal while another process clones or fetches into cache
+	unlock, err := mgr.lock(cached.Dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := mgr.fs.RemoveAll(cached.Dir); err != nil {
+		return err
+	}
+
+	if err := mgr.fs.Remove(metadataFile(cached.Dir)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Remove all cached repositories
+func (mgr *manager) ClearCache() error {
+	mgr.logger.WithField("dir", mgr.cacheDir).Debug("Clearing cache...")
+
+	caches, err := mgr.ListCache()
+	if err != nil {
+		return err
+	}
+
+	for _, cached := range caches {
+		if err := mgr.RemoveCache(cached); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
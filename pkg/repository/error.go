@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"errors"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"os"
+)
+
+/*********/
+/* Error */
+/*********/
+
+type ErrorKind string
+
+const (
+	ErrorNotFound   ErrorKind = "not found"
+	ErrorInvalidSrc ErrorKind = "invalid source"
+	ErrorAuth       ErrorKind = "authentication failed"
+	ErrorNetwork    ErrorKind = "unreachable"
+	ErrorCorrupt    ErrorKind = "cache corrupt"
+	ErrorNotCached  ErrorKind = "not cached"
+	ErrorLocked     ErrorKind = "locked"
+	ErrorUnknown    ErrorKind = "unusable"
+)
+
+// Repository error, wrapping its cause
+type Error struct {
+	Src  string
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return "repository \"" + e.Src + "\" " + string(e.Kind) + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Suggest a remedy, depending on error kind
+func (e *Error) Remedy() string {
+	switch e.Kind {
+	case ErrorNotFound:
+		return "check repository source for typos, and that it still exists"
+	case ErrorInvalidSrc:
+		return "check repository source is a directory, an archive or a git repository"
+	case ErrorAuth:
+		return "check repository credentials, or configure them in auths config"
+	case ErrorNetwork:
+		return "check network connection, or use --offline to rely on cached repositories"
+	case ErrorCorrupt:
+		return "clear repositories cache using \"manala cache clear\""
+	case ErrorNotCached:
+		return "run once without --offline to cache repository"
+	case ErrorLocked:
+		return "wait for other manala processes, or remove lock file if none is running"
+	}
+
+	return ""
+}
+
+// Wrap err into a repository error, classifying it by its cause
+func newError(src string, err error) *Error {
+	kind := ErrorUnknown
+
+	switch {
+	case isAuthFailure(err):
+		kind = ErrorAuth
+	case errors.Is(err, transport.ErrRepositoryNotFound), errors.Is(err, os.ErrNotExist):
+		kind = ErrorNotFound
+	case isUnreachable(err):
+		kind = ErrorNetwork
+	case errors.Is(err, ErrNotCached):
+		kind = ErrorNotCached
+	case errors.Is(err, ErrLocked):
+		kind = ErrorLocked
+	case errors.Is(err, ErrNotDirectory):
+		kind = ErrorInvalidSrc
+	case errors.Is(err, ErrInvalid):
+		kind = ErrorCorrupt
+	}
+
+	return &Error{Src: src, Kind: kind, Err: err}
+}
+
+// Wrap err into a corrupt cache repository error
+func newCorruptError(src string, err error) *Error {
+	return &Error{Src: src, Kind: ErrorCorrupt, Err: err}
+}
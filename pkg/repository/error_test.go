@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"net"
+	"os"
+	"testing"
+)
+
+func Test_newError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{"not_found", transport.ErrRepositoryNotFound, ErrorNotFound},
+		{"auth_required", transport.ErrAuthenticationRequired, ErrorAuth},
+		{"auth_failed", transport.ErrAuthorizationFailed, ErrorAuth},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrorNetwork},
+		{"not_cached", ErrNotCached, ErrorNotCached},
+		{"invalid_src", &os.PathError{Op: "open", Path: "foo", Err: ErrNotDirectory}, ErrorInvalidSrc},
+		{"corrupt", ErrInvalid, ErrorCorrupt},
+		{"unknown", errors.New("no space left on device"), ErrorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newError("foo.git", tt.err)
+			assert.Equal(t, tt.want, err.Kind)
+			assert.True(t, errors.Is(err, tt.err))
+			assert.Contains(t, err.Error(), tt.err.Error())
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"errors"
+	"github.com/apex/log"
+	"time"
+)
+
+/********/
+/* Lock */
+/********/
+
+var (
+	ErrLocked = errors.New("repository cache locked by another process, lock timeout exceeded")
+)
+
+// Lock timeout exceeded, along with the lock file, which could be left behind by a crashed process on windows
+type LockError struct {
+	File string
+}
+
+func (err *LockError) Error() string {
+	return ErrLocked.Error() + ": " + err.File
+}
+
+func (err *LockError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// Lock polling interval, while waiting for another process to release it
+const lockInterval = 100 * time.Millisecond
+
+// Take an advisory lock on cache directory, shared by every manala process,
+// waiting at most lock timeout for another process to release it.
+// Returns a function releasing lock.
+func (mgr *manager) lock(dir string) (func(), error) {
+	if err := mgr.fs.MkdirAll(mgr.cacheDir, 0755); err != nil {
+		return nil, err
+	}
+
+	file := dir + ".lock"
+	deadline := time.Now().Add(mgr.options.LockTimeout)
+	waiting := false
+
+	for {
+		handle, err := tryLockFile(mgr.fs, file)
+		if err != nil {
+			return nil, err
+		}
+
+		if handle != nil {
+			return func() {
+				if err := unlockFile(mgr.fs, handle, file); err != nil {
+					mgr.logger.WithError(err).WithField("file", file).Warn("Error releasing cache repository lock")
+				}
+			}, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, &LockError{File: file}
+		}
+
+		if !waiting {
+			mgr.logger.WithFields(log.Fields{
+				"file":    file,
+				"timeout": mgr.options.LockTimeout,
+			}).Info("Waiting for cache repository lock, held by another process...")
+			waiting = true
+		}
+
+		time.Sleep(lockInterval)
+	}
+}
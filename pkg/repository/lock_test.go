@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"errors"
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_manager_lock(t *testing.T) {
+	// Cache
+	dir, _ := ioutil.TempDir("", "manala")
+	defer os.RemoveAll(dir)
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	mgr := NewManager(afero.NewOsFs(), logger, dir, false, Options{LockTimeout: 300 * time.Millisecond})
+
+	unlock, err := mgr.lock(filepath.Join(dir, "foo"))
+	assert.Nil(t, err)
+
+	// Locked
+	_, err = mgr.lock(filepath.Join(dir, "foo"))
+	assert.True(t, errors.Is(err, ErrLocked))
+	assert.Equal(t, filepath.Join(dir, "foo.lock"), err.(*LockError).File)
+
+	// Another cache
+	unlockBar, err := mgr.lock(filepath.Join(dir, "bar"))
+	assert.Nil(t, err)
+	unlockBar()
+
+	// Released while waiting
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		unlock()
+	}()
+	unlockAgain, err := mgr.lock(filepath.Join(dir, "foo"))
+	assert.Nil(t, err)
+	unlockAgain()
+}
+
+func Test_manager_RemoveCache_locked(t *testing.T) {
+	// Cache
+	dir, _ := ioutil.TempDir("", "manala")
+	defer os.RemoveAll(dir)
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	mgr := NewManager(afero.NewOsFs(), logger, dir, false, Options{LockTimeout: 300 * time.Millisecond})
+
+	_ = os.MkdirAll(filepath.Join(dir, "foo"), 0755)
+
+	unlock, err := mgr.lock(filepath.Join(dir, "foo"))
+	assert.Nil(t, err)
+
+	// Not removed while locked by a clone or a fetch
+	err = mgr.RemoveCache(&CachedRepository{Dir: filepath.Join(dir, "foo")})
+	assert.True(t, errors.Is(err, ErrLocked))
+	exists, _ := afero.DirExists(afero.NewOsFs(), filepath.Join(dir, "foo"))
+	assert.True(t, exists)
+
+	unlock()
+
+	assert.Nil(t, mgr.RemoveCache(&CachedRepository{Dir: filepath.Join(dir, "foo")}))
+	exists, _ = afero.DirExists(afero.NewOsFs(), filepath.Join(dir, "foo"))
+	assert.False(t, exists)
+}
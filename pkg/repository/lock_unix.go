@@ -0,0 +1,59 @@
+//go:build !windows
+// +build !windows
+
+package repository
+
+import (
+	"github.com/spf13/afero"
+	"os"
+	"syscall"
+)
+
+// Try to lock file, using flock, released by the system if process dies.
+// Files not backed by the os, as in memory ones, are private to the process, and need no flock.
+// Returns a nil handle if already locked.
+func tryLockFile(fs afero.Fs, file string) (afero.File, error) {
+	handle, err := fs.OpenFile(file, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	osHandle, ok := osFile(handle)
+	if !ok {
+		return handle, nil
+	}
+
+	if err := syscall.Flock(int(osHandle.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		handle.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return handle, nil
+}
+
+// Release file lock, keeping file, as another process could be waiting on it
+func unlockFile(fs afero.Fs, handle afero.File, file string) error {
+	defer handle.Close()
+
+	osHandle, ok := osFile(handle)
+	if !ok {
+		return nil
+	}
+
+	return syscall.Flock(int(osHandle.Fd()), syscall.LOCK_UN)
+}
+
+// Get handle underlying os file, if any
+func osFile(handle afero.File) (*os.File, bool) {
+	switch handle := handle.(type) {
+	case *os.File:
+		return handle, true
+	case *afero.BasePathFile:
+		return osFile(handle.File)
+	}
+
+	return nil, false
+}
@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+package repository
+
+import (
+	"github.com/spf13/afero"
+	"os"
+)
+
+// Try to lock file, by exclusively creating it.
+// File is left behind if process dies, and must then be removed by hand.
+// Returns a nil handle if already locked.
+func tryLockFile(fs afero.Fs, file string) (afero.File, error) {
+	handle, err := fs.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return handle, nil
+}
+
+func unlockFile(fs afero.Fs, handle afero.File, file string) error {
+	if err := handle.Close(); err != nil {
+		return err
+	}
+
+	return fs.Remove(file)
+}
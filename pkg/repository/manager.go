@@ -3,13 +3,21 @@ package repository
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"github.com/apex/log"
 	"github.com/spf13/afero"
 	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"manala/pkg/repository/builtin"
+	"net"
+	"net/url"
 	"os"
 	"path"
-	"path/filepath"
+	"time"
 )
 
 /**********************/
@@ -18,27 +26,67 @@ import (
 
 type ManagedRepository struct {
 	Interface
-	dir string
+	name   string
+	dir    string
+	tags   []string
+	commit string
+}
+
+// Get repository name, either its alias, or its source base name
+func (rep *ManagedRepository) GetName() string {
+	return rep.name
 }
 
 func (rep *ManagedRepository) GetDir() string {
 	return rep.dir
 }
 
+// Get repository tags, if any
+func (rep *ManagedRepository) GetTags() []string {
+	return rep.tags
+}
+
+// Get repository worktree commit, if any
+func (rep *ManagedRepository) GetCommit() string {
+	return rep.commit
+}
+
 /***********/
 /* Manager */
 /***********/
 
 type ManagerInterface interface {
-	Create(src string) (*ManagedRepository, error)
+	Create(src string, ref string) (*ManagedRepository, error)
+	Resolve(src string) string
+	Name(src string) string
+	CacheSrc(src string) (string, bool)
+	ListCache() ([]*CachedRepository, error)
+	RemoveCache(cached *CachedRepository) error
+	ClearCache() error
+}
+
+type Options struct {
+	// Repositories sources, by alias name
+	Aliases map[string]string
+	// Use cached repositories as-is, without reaching remotes
+	Offline bool
+	// Cached repositories fetched more recently than ttl are not fetched again
+	TTL time.Duration
+	// Force cached repositories fetch, whatever their ttl
+	Refresh bool
+	// Git repositories authentications
+	Auths []Auth
+	// Maximum time to wait for a cache repository locked by another process
+	LockTimeout time.Duration
 }
 
-func NewManager(fs afero.Fs, logger log.Interface, cacheDir string, debug bool) *manager {
+func NewManager(fs afero.Fs, logger log.Interface, cacheDir string, debug bool, options Options) *manager {
 	return &manager{
 		fs:       fs,
 		logger:   logger,
 		cacheDir: cacheDir,
 		debug:    debug,
+		options:  options,
 	}
 }
 
@@ -47,20 +95,122 @@ type manager struct {
 	logger   log.Interface
 	cacheDir string
 	debug    bool
+	options  Options
 }
 
-func (mgr *manager) Create(src string) (*ManagedRepository, error) {
-	switch {
-	case filepath.Ext(src) == ".git":
-		return mgr.createGit(src)
+// Create a repository from src, at ref if supported and not empty.
+// Src could also be an alias name.
+func (mgr *manager) Create(src string, ref string) (*ManagedRepository, error) {
+	name := mgr.Name(src)
+
+	if alias := mgr.Resolve(src); alias != src {
+		mgr.logger.WithFields(log.Fields{
+			"alias": src,
+			"src":   alias,
+		}).Debug("Resolving repository alias...")
+		src = alias
+	}
+
+	// Subdirectory sources share their underlying repository cache
+	base, subdir := splitSourceSubdir(src)
+
+	kind, location, err := mgr.parseSource(base)
+	if err != nil {
+		return nil, newError(src, err)
+	}
+
+	var rep *ManagedRepository
+
+	switch kind {
+	case sourceArchive:
+		rep, err = mgr.createArchive(location, ref)
+	case sourceGit:
+		rep, err = mgr.createGit(location, ref)
+	case sourceBuiltin:
+		rep, err = mgr.createBuiltin()
+	default:
+		rep, err = mgr.createDirectory(location)
+	}
+
+	if err != nil {
+		return nil, err
 	}
 
-	return mgr.createDirectory(src)
+	if subdir != "" {
+		if ok, _ := afero.DirExists(rep.GetFs(), subdir); !ok {
+			return nil, newError(src, &os.PathError{Op: "open", Path: subdir, Err: os.ErrNotExist})
+		}
+
+		rep = &ManagedRepository{
+			Interface: &repository{
+				src: src,
+				fs:  afero.NewBasePathFs(rep.GetFs(), subdir),
+			},
+			dir:    path.Join(rep.GetDir(), subdir),
+			tags:   rep.GetTags(),
+			commit: rep.GetCommit(),
+		}
+	}
+
+	rep.name = name
+
+	return rep, nil
 }
 
-func (mgr *manager) createDirectory(src string) (*ManagedRepository, error) {
-	// Todo: ensure src exists...
+// Resolve src, which could be an alias name
+func (mgr *manager) Resolve(src string) string {
+	if alias, ok := mgr.options.Aliases[src]; ok {
+		return alias
+	}
+
+	return src
+}
+
+// Get the source src repository is cached under, as recorded in its cache metadata,
+// without creating it; false if src repository is never cached, as directories.
+func (mgr *manager) CacheSrc(src string) (string, bool) {
+	// Subdirectory sources share their underlying repository cache
+	base, _ := splitSourceSubdir(mgr.Resolve(src))
+
+	kind, location, err := mgr.parseSource(base)
+	if err != nil {
+		return "", false
+	}
+
+	switch kind {
+	case sourceGit, sourceArchive:
+		return location, true
+	}
+
+	return "", false
+}
+
+// Get src repository name, without creating it; either its alias, or its source base name
+func (mgr *manager) Name(src string) string {
+	if _, ok := mgr.options.Aliases[src]; ok {
+		return src
+	}
 
+	return sourceName(src)
+}
+
+func (mgr *manager) createBuiltin() (*ManagedRepository, error) {
+	fs, err := builtin.Fs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Instantiate repository
+	return &ManagedRepository{
+		Interface: &repository{
+			src: BuiltinSrc,
+			fs:  fs,
+		},
+		dir: BuiltinSrc,
+	}, nil
+}
+
+func (mgr *manager) createDirectory(src string) (*ManagedRepository, error) {
 	// Instantiate repository
 	return &ManagedRepository{
 		Interface: &repository{
@@ -71,7 +221,7 @@ func (mgr *manager) createDirectory(src string) (*ManagedRepository, error) {
 	}, nil
 }
 
-func (mgr *manager) createGit(src string) (*ManagedRepository, error) {
+func (mgr *manager) createGit(src string, ref string) (*ManagedRepository, error) {
 	// Send git progress human readable information to stdout if debug enabled
 	gitProgress := sideband.Progress(nil)
 	if mgr.debug {
@@ -81,60 +231,316 @@ func (mgr *manager) createGit(src string) (*ManagedRepository, error) {
 	hash := md5.New()
 	hash.Write([]byte(src))
 
+	// Each pinned ref get its own worktree
+	if ref != "" {
+		hash.Write([]byte("#" + ref))
+	}
+
 	// Repository cache directory should be unique
 	dir := path.Join(mgr.cacheDir, hex.EncodeToString(hash.Sum(nil)))
 
-	mgr.logger.WithField("dir", mgr).Debug("Opening cache repository...")
+	// Prevent concurrent processes from cloning, fetching or checking out the same cache
+	unlock, err := mgr.lock(dir)
+	if err != nil {
+		return nil, newError(src, err)
+	}
+	defer unlock()
+
+	md, err := mgr.readMetadata(dir)
+	if err != nil {
+		return nil, err
+	}
+	if md == nil {
+		md = &metadata{Src: src, Ref: ref}
+	}
+
+	mgr.logger.WithField("dir", dir).Debug("Opening cache repository...")
 
 	gitRepository, err := git.PlainOpen(dir)
 
-	if err != nil {
-		switch err {
-		case git.ErrRepositoryNotExists:
-			mgr.logger.Debug("Cloning cache git repository...")
+	// Clone missing cache, or clone again corrupt one
+	clone := false
 
-			gitRepository, err = git.PlainClone(dir, false, &git.CloneOptions{
-				URL:               src,
-				RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
-				Progress:          gitProgress,
-			})
+	switch {
+	case err == git.ErrRepositoryNotExists:
+		if mgr.options.Offline {
+			return nil, newError(src, ErrNotCached)
+		}
+		if ok, _ := afero.DirExists(mgr.fs, dir); ok {
+			mgr.logger.Warn("Cache repository incomplete, repairing...")
+		}
+		clone = true
+	case err != nil:
+		if mgr.options.Offline {
+			return nil, newCorruptError(src, err)
+		}
+		mgr.logger.WithError(err).Warn("Cache repository corrupt, repairing...")
+		clone = true
+	case mgr.options.Offline:
+		mgr.logger.WithField("age", md.age()).Info("Offline, using cache repository")
+	case mgr.isFresh(md) && hasGitRef(gitRepository, ref):
+		// Pinned ref missing from a fresh cache, as a just pushed tag, still get fetched
+		mgr.logger.WithField("age", md.age()).Debug("Cache repository fresh, skipping fetch")
+	default:
+		gitAuth, err := mgr.gitAuth(src)
+		if err != nil {
+			return nil, &Error{Src: src, Kind: ErrorAuth, Err: err}
+		}
 
-			if err != nil {
-				return nil, ErrUnclonable
-			}
+		err = mgr.updateGit(gitRepository, ref, gitAuth, gitProgress)
+
+		switch {
+		case err == nil:
+			md.LastFetch = time.Now()
+		case isUnreachable(err):
+			// Fallback on cache
+			mgr.logger.WithError(err).WithField("age", md.age()).Warn("Repository unreachable, using cache repository")
+		case isAuthFailure(err):
+			return nil, newError(src, err)
+		case err == ErrRefNotFound:
+			// Cache is fine, remote just lacks pinned ref
+			return nil, err
 		default:
-			return nil, ErrUnopenable
+			mgr.logger.WithError(err).Warn("Cache repository unrecoverable, repairing...")
+			clone = true
 		}
-	} else {
-		mgr.logger.Debug("Getting cache git repository worktree...")
+	}
 
-		gitRepositoryWorktree, err := gitRepository.Worktree()
+	if clone {
+		gitAuth, err := mgr.gitAuth(src)
+		if err != nil {
+			return nil, &Error{Src: src, Kind: ErrorAuth, Err: err}
+		}
 
+		gitRepository, err = mgr.cloneGit(src, dir, gitAuth, gitProgress)
 		if err != nil {
-			return nil, ErrInvalid
+			return nil, newError(src, err)
 		}
 
-		mgr.logger.Debug("Pulling cache git repository worktree...")
+		md.LastFetch = time.Now()
+	}
 
-		err = gitRepositoryWorktree.Pull(&git.PullOptions{
-			RemoteName: "origin",
-			Progress:   gitProgress,
-		})
+	md.LastUse = time.Now()
+	if err := mgr.writeMetadata(dir, md); err != nil {
+		return nil, err
+	}
 
+	if ref != "" {
+		err = mgr.checkoutGit(gitRepository, ref)
 		if err != nil {
-			switch err {
-			case git.NoErrAlreadyUpToDate:
-			default:
+			if err == ErrRefNotFound {
 				return nil, err
 			}
+			return nil, newError(src, err)
 		}
 	}
 
+	// Tags
+	var tags []string
+	gitTags, err := gitRepository.Tags()
+	if err != nil {
+		return nil, newCorruptError(src, err)
+	}
+	_ = gitTags.ForEach(func(tag *plumbing.Reference) error {
+		tags = append(tags, tag.Name().Short())
+		return nil
+	})
+
+	// Commit
+	head, err := gitRepository.Head()
+	if err != nil {
+		return nil, newCorruptError(src, err)
+	}
+
 	return &ManagedRepository{
 		Interface: &repository{
 			src: src,
 			fs:  afero.NewBasePathFs(mgr.fs, dir),
 		},
-		dir: dir,
+		dir:    dir,
+		tags:   tags,
+		commit: head.Hash().String(),
 	}, nil
 }
+
+// Cache directory has been fetched within ttl, and refresh not forced
+func (mgr *manager) isFresh(md *metadata) bool {
+	if mgr.options.Refresh || mgr.options.TTL <= 0 || md.LastFetch.IsZero() {
+		return false
+	}
+
+	return time.Since(md.LastFetch) < mgr.options.TTL
+}
+
+// Clone git repository atomically, into a temporary directory then renamed to dir,
+// so that an interrupted clone never leaves a half-finished cache behind
+func (mgr *manager) cloneGit(src string, dir string, gitAuth transport.AuthMethod, gitProgress sideband.Progress) (*git.Repository, error) {
+	if err := mgr.fs.MkdirAll(mgr.cacheDir, 0755); err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := afero.TempDir(mgr.fs, mgr.cacheDir, ".clone-")
+	if err != nil {
+		return nil, err
+	}
+	defer mgr.fs.RemoveAll(tmpDir)
+
+	mgr.logger.WithField("dir", tmpDir).Debug("Cloning cache git repository...")
+
+	_, err = git.PlainClone(tmpDir, false, &git.CloneOptions{
+		URL:               src,
+		Auth:              gitAuth,
+		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		Progress:          gitProgress,
+		Tags:              git.AllTags,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mgr.fs.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+
+	if err := mgr.fs.Rename(tmpDir, dir); err != nil {
+		return nil, err
+	}
+
+	return git.PlainOpen(dir)
+}
+
+// Update git repository from its remote, hard resetting worktree
+// so that local modifications or force pushed branches never get in the way
+func (mgr *manager) updateGit(gitRepository *git.Repository, ref string, gitAuth transport.AuthMethod, gitProgress sideband.Progress) error {
+	mgr.logger.Debug("Fetching cache git repository...")
+
+	err := gitRepository.Fetch(&git.FetchOptions{
+		RemoteName: "origin",
+		Auth:       gitAuth,
+		Progress:   gitProgress,
+		Tags:       git.AllTags,
+		Force:      true,
+	})
+
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	// Pinned ref worktree get checked out afterwards
+	if ref != "" {
+		if !hasGitRef(gitRepository, ref) {
+			return ErrRefNotFound
+		}
+		return nil
+	}
+
+	head, err := gitRepository.Head()
+	if err != nil || !head.Name().IsBranch() {
+		return ErrInvalid
+	}
+
+	remote, err := gitRepository.Reference(plumbing.NewRemoteReferenceName("origin", head.Name().Short()), true)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	gitRepositoryWorktree, err := gitRepository.Worktree()
+	if err != nil {
+		return ErrInvalid
+	}
+
+	status, err := gitRepositoryWorktree.Status()
+	if err != nil {
+		return ErrInvalid
+	}
+
+	if !status.IsClean() {
+		mgr.logger.Warn("Cache repository worktree modified, discarding modifications...")
+	}
+
+	if head.Hash() != remote.Hash() && !isAncestor(gitRepository, head.Hash(), remote.Hash()) {
+		mgr.logger.WithField("branch", head.Name().Short()).Warn("Cache repository diverged from remote, resetting...")
+	}
+
+	mgr.logger.Debug("Resetting cache git repository worktree...")
+
+	err = gitRepositoryWorktree.Reset(&git.ResetOptions{
+		Commit: remote.Hash(),
+		Mode:   git.HardReset,
+	})
+	if err != nil {
+		return err
+	}
+
+	return gitRepositoryWorktree.Clean(&git.CleanOptions{Dir: true})
+}
+
+// Check whether ancestor hash is reachable from hash history
+func isAncestor(gitRepository *git.Repository, ancestor plumbing.Hash, hash plumbing.Hash) bool {
+	commits, err := gitRepository.Log(&git.LogOptions{From: hash})
+	if err != nil {
+		return false
+	}
+
+	found := false
+	_ = commits.ForEach(func(commit *object.Commit) error {
+		if commit.Hash == ancestor {
+			found = true
+			return storer.ErrStop
+		}
+		return nil
+	})
+
+	return found
+}
+
+// Remote is unreachable, either because of network, or because it has gone away.
+// Go-git http and git transports errors are, or wrap, net ones; local and file ones report a missing repository.
+func isUnreachable(err error) bool {
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr) || errors.Is(err, transport.ErrRepositoryNotFound)
+}
+
+// Checkout git repository worktree at ref, which could be a remote branch, a tag or a commit hash
+func (mgr *manager) checkoutGit(gitRepository *git.Repository, ref string) error {
+	mgr.logger.WithField("ref", ref).Debug("Checking out cache git repository worktree...")
+
+	hash, err := resolveGitRef(gitRepository, ref)
+	if err != nil {
+		return err
+	}
+
+	gitRepositoryWorktree, err := gitRepository.Worktree()
+	if err != nil {
+		return ErrInvalid
+	}
+
+	return gitRepositoryWorktree.Checkout(&git.CheckoutOptions{
+		Hash:  *hash,
+		Force: true,
+	})
+}
+
+// Resolve ref, which could be a remote branch, a tag or a commit hash
+func resolveGitRef(gitRepository *git.Repository, ref string) (*plumbing.Hash, error) {
+	hash, err := gitRepository.ResolveRevision(plumbing.Revision("refs/remotes/origin/" + ref))
+	if err != nil {
+		hash, err = gitRepository.ResolveRevision(plumbing.Revision(ref))
+		if err != nil {
+			return nil, ErrRefNotFound
+		}
+	}
+
+	return hash, nil
+}
+
+// Check whether git repository holds ref, if any
+func hasGitRef(gitRepository *git.Repository, ref string) bool {
+	if ref == "" {
+		return true
+	}
+
+	_, err := resolveGitRef(gitRepository, ref)
+	return err == nil
+}
@@ -0,0 +1,441 @@
+package repository
+
+import (
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_manager_isFresh(t *testing.T) {
+	// File system
+	fs := afero.NewMemMapFs()
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	mgr := NewManager(fs, logger, "", false, Options{})
+
+	fresh := &metadata{Src: "foo", LastFetch: time.Now().Add(-time.Minute)}
+	stale := &metadata{Src: "foo", LastFetch: time.Now().Add(-time.Hour)}
+	unknown := &metadata{Src: "foo"}
+
+	tests := []struct {
+		name    string
+		options Options
+		md      *metadata
+		want    bool
+	}{
+		{"fresh", Options{TTL: 5 * time.Minute}, fresh, true},
+		{"stale", Options{TTL: 5 * time.Minute}, stale, false},
+		{"unknown", Options{TTL: 5 * time.Minute}, unknown, false},
+		{"no_ttl", Options{}, fresh, false},
+		{"refresh", Options{TTL: 5 * time.Minute, Refresh: true}, fresh, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mgr.options = tt.options
+			assert.Equal(t, tt.want, mgr.isFresh(tt.md))
+		})
+	}
+}
+
+func Test_manager_cache(t *testing.T) {
+	// File system
+	fs := afero.NewMemMapFs()
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	mgr := NewManager(fs, logger, "/cache", false, Options{})
+
+	_ = afero.WriteFile(fs, "/cache/foo/file", []byte("foo"), 0666)
+	_ = mgr.writeMetadata("/cache/foo", &metadata{Src: "foo.git", Ref: "v1.0.0"})
+	_ = afero.WriteFile(fs, "/cache/bar/file", []byte("bar bar"), 0666)
+
+	caches, err := mgr.ListCache()
+	assert.Nil(t, err)
+	assert.Len(t, caches, 2)
+	assert.Equal(t, &CachedRepository{Dir: "/cache/bar", Size: 7}, caches[0])
+	assert.Equal(t, &CachedRepository{Dir: "/cache/foo", Src: "foo.git", Ref: "v1.0.0", Size: 3}, caches[1])
+
+	assert.Nil(t, mgr.RemoveCache(caches[1]))
+	exists, _ := afero.Exists(fs, "/cache/foo.yaml")
+	assert.False(t, exists)
+
+	caches, _ = mgr.ListCache()
+	assert.Len(t, caches, 1)
+
+	assert.Nil(t, mgr.ClearCache())
+	caches, err = mgr.ListCache()
+	assert.Nil(t, err)
+	assert.Len(t, caches, 0)
+}
+
+func Test_manager_createBuiltin(t *testing.T) {
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	mgr := NewManager(afero.NewMemMapFs(), logger, "", false, Options{})
+
+	rep, err := mgr.Create(BuiltinSrc, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "builtin", rep.GetName())
+
+	exists, _ := afero.Exists(rep.GetFs(), "default/.manala.yaml")
+	assert.True(t, exists)
+
+	// Read only
+	err = afero.WriteFile(rep.GetFs(), "default/foo", []byte("foo"), 0644)
+	assert.Error(t, err)
+}
+
+func Test_manager_Create_alias(t *testing.T) {
+	// File system
+	fs := afero.NewMemMapFs()
+	_ = fs.MkdirAll("/repositories/foo/bar", 0755)
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	mgr := NewManager(fs, logger, "", false, Options{
+		Aliases: map[string]string{"company": "/repositories/foo"},
+	})
+
+	tests := []struct {
+		name     string
+		src      string
+		wantName string
+		wantSrc  string
+		wantErr  bool
+	}{
+		{"alias", "company", "company", "/repositories/foo", false},
+		{"source", "/repositories/foo", "foo", "/repositories/foo", false},
+		{"unknown_alias", "team", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep, err := mgr.Create(tt.src, "")
+			if tt.wantErr {
+				assert.IsType(t, &Error{}, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantName, rep.GetName())
+			assert.Equal(t, tt.wantName, mgr.Name(tt.src))
+			assert.Equal(t, tt.wantSrc, rep.GetSrc())
+			assert.Equal(t, tt.wantSrc, mgr.Resolve(tt.src))
+
+			exists, _ := afero.DirExists(rep.GetFs(), "bar")
+			assert.True(t, exists)
+		})
+	}
+}
+
+// Run git command into dir
+func gitCommand(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=foo", "GIT_AUTHOR_EMAIL=foo@example.com",
+		"GIT_COMMITTER_NAME=foo", "GIT_COMMITTER_EMAIL=foo@example.com",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %s", args, out)
+	}
+}
+
+// Commit file "foo" with content into work dir, and push it to its origin
+func gitCommitPush(t *testing.T, work string, content string) {
+	t.Helper()
+
+	_ = ioutil.WriteFile(filepath.Join(work, "foo"), []byte(content), 0666)
+	gitCommand(t, work, "add", "foo")
+	gitCommand(t, work, "commit", "-q", "-m", content)
+	gitCommand(t, work, "push", "-q", "--tags", "origin", "master")
+}
+
+// Bare git repository fixture, with a "master" branch whose file "foo" content is "v1",
+// along with a work dir to push further commits from
+func gitFixture(t *testing.T) (string, string) {
+	t.Helper()
+
+	dir, _ := ioutil.TempDir("", "manala")
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	bare := filepath.Join(dir, "repository.git")
+	work := filepath.Join(dir, "work")
+
+	gitCommand(t, dir, "init", "-q", "--bare", bare)
+	gitCommand(t, bare, "symbolic-ref", "HEAD", "refs/heads/master")
+	gitCommand(t, dir, "init", "-q", work)
+	gitCommand(t, work, "checkout", "-q", "-b", "master")
+	gitCommand(t, work, "remote", "add", "origin", bare)
+	gitCommitPush(t, work, "v1")
+
+	return bare, work
+}
+
+// Git manager, with its own temporary cache dir
+func gitManager(t *testing.T, options Options) *manager {
+	t.Helper()
+
+	cacheDir, _ := ioutil.TempDir("", "manala")
+	t.Cleanup(func() { _ = os.RemoveAll(cacheDir) })
+
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	return NewManager(afero.NewOsFs(), logger, cacheDir, false, options)
+}
+
+func gitFile(rep *ManagedRepository) string {
+	content, _ := afero.ReadFile(rep.GetFs(), "foo")
+	return string(content)
+}
+
+func Test_manager_createGit_unreachable(t *testing.T) {
+	bare, work := gitFixture(t)
+	src := "file://" + bare
+	mgr := gitManager(t, Options{})
+
+	rep, err := mgr.Create(src, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", gitFile(rep))
+
+	gitCommitPush(t, work, "v2")
+
+	// Network failure falls back on cache
+	gitCommand(t, rep.GetDir(), "remote", "set-url", "origin", "http://127.0.0.1:1/repository.git")
+	rep, err = mgr.Create(src, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", gitFile(rep))
+
+	// So does a remote gone away
+	gitCommand(t, rep.GetDir(), "remote", "set-url", "origin", src)
+	_ = os.Rename(bare, bare+".gone")
+	rep, err = mgr.Create(src, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", gitFile(rep))
+}
+
+func Test_manager_createGit_offline(t *testing.T) {
+	bare, work := gitFixture(t)
+	mgr := gitManager(t, Options{Offline: true})
+
+	// Not cached yet
+	_, err := mgr.Create(bare, "")
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, ErrorNotCached, err.(*Error).Kind)
+
+	mgr.options = Options{}
+	_, _ = mgr.Create(bare, "")
+
+	gitCommitPush(t, work, "v2")
+
+	// Cached, never fetched
+	mgr.options = Options{Offline: true}
+	rep, err := mgr.Create(bare, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", gitFile(rep))
+}
+
+func Test_manager_createGit_ttl(t *testing.T) {
+	bare, work := gitFixture(t)
+	mgr := gitManager(t, Options{TTL: time.Hour})
+
+	_, err := mgr.Create(bare, "")
+	assert.Nil(t, err)
+
+	_, err = mgr.Create(bare, "v2.0.0")
+	assert.Equal(t, ErrRefNotFound, err)
+
+	gitCommand(t, work, "tag", "v2.0.0")
+	gitCommitPush(t, work, "v3")
+
+	// Fresh cache skips fetch
+	rep, err := mgr.Create(bare, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", gitFile(rep))
+
+	// Unless pinned ref is missing from it
+	rep, err = mgr.Create(bare, "v2.0.0")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", gitFile(rep))
+	assert.Contains(t, rep.GetTags(), "v2.0.0")
+}
+
+func Test_manager_createGit(t *testing.T) {
+	bare, work := gitFixture(t)
+	mgr := gitManager(t, Options{})
+
+	rep, err := mgr.Create(bare, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", gitFile(rep))
+
+	// Cloned atomically, leaving no temporary directory behind
+	dirs, _ := filepath.Glob(filepath.Join(mgr.cacheDir, ".clone-*"))
+	assert.Empty(t, dirs)
+
+	// Worktree modifications are discarded on update
+	gitCommitPush(t, work, "v2")
+	_ = ioutil.WriteFile(filepath.Join(rep.GetDir(), "foo"), []byte("modified"), 0666)
+	_ = ioutil.WriteFile(filepath.Join(rep.GetDir(), "bar"), []byte("untracked"), 0666)
+
+	rep, err = mgr.Create(bare, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", gitFile(rep))
+	exists, _ := afero.Exists(rep.GetFs(), "bar")
+	assert.False(t, exists)
+
+	// So is a diverged history
+	_ = ioutil.WriteFile(filepath.Join(rep.GetDir(), "foo"), []byte("diverged"), 0666)
+	gitCommand(t, rep.GetDir(), "commit", "-q", "-a", "-m", "diverged")
+	gitCommitPush(t, work, "v3")
+
+	rep, err = mgr.Create(bare, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v3", gitFile(rep))
+}
+
+func Test_manager_createGit_repair(t *testing.T) {
+	bare, _ := gitFixture(t)
+	mgr := gitManager(t, Options{})
+
+	rep, _ := mgr.Create(bare, "")
+
+	// Incomplete
+	_ = os.RemoveAll(filepath.Join(rep.GetDir(), ".git"))
+	rep, err := mgr.Create(bare, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", gitFile(rep))
+
+	// Corrupt
+	_ = ioutil.WriteFile(filepath.Join(rep.GetDir(), ".git", "config"), []byte("[corrupt"), 0666)
+	rep, err = mgr.Create(bare, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", gitFile(rep))
+}
+
+func Test_manager_createGit_ref(t *testing.T) {
+	bare, work := gitFixture(t)
+	mgr := gitManager(t, Options{})
+
+	gitCommand(t, work, "tag", "v1.0.0")
+	gitCommitPush(t, work, "v2")
+	gitCommand(t, work, "checkout", "-q", "-b", "next")
+	gitCommitPush(t, work, "v3")
+	gitCommand(t, work, "push", "-q", "origin", "next")
+
+	master, _ := mgr.Create(bare, "")
+	tag, _ := mgr.Create(bare, "v1.0.0")
+
+	tests := []struct {
+		name string
+		ref  string
+		want string
+	}{
+		{"tag", "v1.0.0", "v1"},
+		{"default_branch", "master", "v2"},
+		{"branch", "next", "v3"},
+		{"commit", tag.GetCommit(), "v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep, err := mgr.Create(bare, tt.ref)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, gitFile(rep))
+			assert.NotEqual(t, master.GetDir(), rep.GetDir())
+		})
+	}
+}
+
+func Test_manager_createGit_refNotFound(t *testing.T) {
+	bare, _ := gitFixture(t)
+	mgr := gitManager(t, Options{})
+
+	_, err := mgr.Create(bare, "foo")
+	assert.Equal(t, ErrRefNotFound, err)
+
+	caches, _ := mgr.ListCache()
+	assert.Len(t, caches, 1)
+	_ = ioutil.WriteFile(filepath.Join(caches[0].Dir, "marker"), []byte(""), 0666)
+
+	// Fails fast, without cloning again
+	_, err = mgr.Create(bare, "foo")
+	assert.Equal(t, ErrRefNotFound, err)
+	exists, _ := afero.Exists(mgr.fs, filepath.Join(caches[0].Dir, "marker"))
+	assert.True(t, exists)
+}
+
+func Test_manager_CacheSrc(t *testing.T) {
+	bare, work := gitFixture(t)
+	mgr := gitManager(t, Options{
+		Aliases: map[string]string{"company": "git::file://" + bare + "//bar"},
+	})
+
+	_ = os.Mkdir(filepath.Join(work, "bar"), 0755)
+	_ = ioutil.WriteFile(filepath.Join(work, "bar", "baz"), []byte("baz"), 0666)
+	gitCommand(t, work, "add", "bar")
+	gitCommand(t, work, "commit", "-q", "-m", "bar")
+	gitCommand(t, work, "push", "-q", "origin", "master")
+
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"source", "file://" + bare},
+		{"subdir", "file://" + bare + "//bar"},
+		{"forced_git", "git::file://" + bare},
+		{"alias", "company"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mgr.Create(tt.src, "")
+			assert.Nil(t, err)
+
+			// Same source as recorded into cache metadata
+			src, ok := mgr.CacheSrc(tt.src)
+			assert.True(t, ok)
+			caches, _ := mgr.ListCache()
+			assert.Len(t, caches, 1)
+			assert.Equal(t, caches[0].Src, src)
+		})
+	}
+
+	t.Run("uncached", func(t *testing.T) {
+		for _, src := range []string{work, BuiltinSrc, "/missing"} {
+			_, ok := mgr.CacheSrc(src)
+			assert.False(t, ok)
+		}
+	})
+}
+
+func Test_isAncestor(t *testing.T) {
+	bare, work := gitFixture(t)
+	gitCommitPush(t, work, "v2")
+
+	gitRepository, _ := git.PlainOpen(bare)
+	head, _ := gitRepository.Head()
+	parent, _ := gitRepository.ResolveRevision(plumbing.Revision("master~1"))
+
+	assert.True(t, isAncestor(gitRepository, *parent, head.Hash()))
+	assert.True(t, isAncestor(gitRepository, head.Hash(), head.Hash()))
+	assert.False(t, isAncestor(gitRepository, head.Hash(), *parent))
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+	"os"
+	"time"
+)
+
+/************/
+/* Metadata */
+/************/
+
+// Cache metadata, stored alongside each repository cache directory
+type metadata struct {
+	Src       string    `yaml:"src"`
+	Ref       string    `yaml:"ref,omitempty"`
+	LastFetch time.Time `yaml:"last_fetch"`
+	LastUse   time.Time `yaml:"last_use"`
+	// Archives http caching headers, or local file modification date
+	ETag         string `yaml:"etag,omitempty"`
+	LastModified string `yaml:"last_modified,omitempty"`
+}
+
+// Get human readable age, since last fetch
+func (md *metadata) age() string {
+	if md.LastFetch.IsZero() {
+		return "unknown"
+	}
+
+	return time.Since(md.LastFetch).Round(time.Second).String()
+}
+
+func metadataFile(dir string) string {
+	return dir + ".yaml"
+}
+
+// Read cache directory metadata, if any
+func (mgr *manager) readMetadata(dir string) (*metadata, error) {
+	content, err := afero.ReadFile(mgr.fs, metadataFile(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	md := &metadata{}
+	if err := yaml.Unmarshal(content, md); err != nil {
+		return nil, err
+	}
+
+	return md, nil
+}
+
+func (mgr *manager) writeMetadata(dir string, md *metadata) error {
+	content, err := yaml.Marshal(md)
+	if err != nil {
+		return err
+	}
+
+	return afero.WriteFile(mgr.fs, metadataFile(dir), content, 0666)
+}
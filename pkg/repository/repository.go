@@ -3,12 +3,16 @@ package repository
 import (
 	"errors"
 	"github.com/spf13/afero"
+	"path"
+	"path/filepath"
+	"strings"
 )
 
 var (
-	ErrUnclonable = errors.New("repository unclonable")
-	ErrUnopenable = errors.New("repository unopenable")
-	ErrInvalid    = errors.New("repository invalid")
+	ErrInvalid      = errors.New("repository invalid")
+	ErrNotDirectory = errors.New("repository source not a directory")
+	ErrRefNotFound  = errors.New("repository ref not found")
+	ErrNotCached    = errors.New("repository not cached, could not be used offline")
 )
 
 type Interface interface {
@@ -28,3 +32,25 @@ func (rep *repository) GetSrc() string {
 func (rep *repository) GetFs() afero.Fs {
 	return rep.fs
 }
+
+// Name a repository after its source base name, without extension, or after its subdirectory one
+// Example: "git@github.com:foo/bar.git" -> "bar"
+// Example: "git@github.com:foo/bar.git//baz/qux" -> "qux"
+func sourceName(src string) string {
+	src, subdir := splitSourceSubdir(src)
+	if subdir != "" {
+		return path.Base(subdir)
+	}
+
+	src, _ = splitArchiveSource(src)
+	src = strings.TrimRight(filepath.ToSlash(src), "/")
+	name := path.Base(src[strings.LastIndex(src, ":")+1:])
+
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+
+	return strings.TrimSuffix(name, path.Ext(name))
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_sourceName(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"git@github.com:foo/bar.git", "bar"},
+		{"https://github.com/foo/bar.git", "bar"},
+		{"https://github.com/foo/bar", "bar"},
+		{"/foo/bar/", "bar"},
+		{"bar", "bar"},
+		{"https://example.com/foo/bar.tar.gz?checksum=sha256:abcd", "bar"},
+		{"/foo/bar.zip", "bar"},
+		{"git@github.com:foo/bar.git//baz/qux", "qux"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			assert.Equal(t, tt.want, sourceName(tt.src))
+		})
+	}
+}
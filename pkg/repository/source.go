@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/**********/
+/* Source */
+/**********/
+
+type sourceKind int
+
+const (
+	sourceDirectory sourceKind = iota
+	sourceGit
+	sourceArchive
+	sourceBuiltin
+)
+
+// Templates embedded in manala binary
+const BuiltinSrc = "builtin"
+
+// Git sources could be forced by this prefix, as in "git::https://example.com/foo"
+const sourceGitPrefix = "git::"
+
+// Scp like ssh syntax, as in "git@github.com:foo/bar.git" or "github.com:foo/bar.git",
+// not to be mistaken for windows drives, as in "C:\foo"
+var sourceScpLikeRegex = regexp.MustCompile(`^(?:[\w.-]+@)?[\w.-]{2,}:[^\\/]`)
+
+var sourceGitSchemes = []string{"ssh://", "git://", "git+ssh://", "http://", "https://", "file://"}
+
+// Parse source kind, and location without its forcing prefix
+func (mgr *manager) parseSource(src string) (sourceKind, string, error) {
+	if src == BuiltinSrc {
+		return sourceBuiltin, src, nil
+	}
+
+	// Forced git
+	if strings.HasPrefix(src, sourceGitPrefix) {
+		return sourceGit, strings.TrimPrefix(src, sourceGitPrefix), nil
+	}
+
+	if isArchive(src) {
+		return sourceArchive, src, nil
+	}
+
+	for _, scheme := range sourceGitSchemes {
+		if strings.HasPrefix(src, scheme) {
+			return sourceGit, src, nil
+		}
+	}
+
+	if sourceScpLikeRegex.MatchString(src) {
+		return sourceGit, src, nil
+	}
+
+	// Local path
+	info, err := mgr.fs.Stat(src)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if !info.IsDir() {
+		return 0, "", &os.PathError{Op: "open", Path: src, Err: ErrNotDirectory}
+	}
+
+	// Bare repository. Git checkouts are deliberately left as plain directories,
+	// so that their uncommitted modifications are still picked up, and watched.
+	// Prefix them with "git::" to use their committed refs instead.
+	if mgr.isBareGit(src) {
+		return sourceGit, src, nil
+	}
+
+	return sourceDirectory, src, nil
+}
+
+// Bare git repository holds its HEAD, objects and refs, without any worktree
+func (mgr *manager) isBareGit(dir string) bool {
+	if ok, _ := afero.Exists(mgr.fs, filepath.Join(dir, "HEAD")); !ok {
+		return false
+	}
+
+	for _, name := range []string{"objects", "refs"} {
+		if ok, _ := afero.DirExists(mgr.fs, filepath.Join(dir, name)); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Split source into its underlying repository and its subdirectory, if any, as in "https://example.com/foo.git//bar"
+// Query, as archives checksum, belongs to the underlying repository.
+func splitSourceSubdir(src string) (string, string) {
+	offset := 0
+	if i := strings.Index(src, "://"); i >= 0 {
+		offset = i + 3
+	}
+
+	i := strings.Index(src[offset:], "//")
+	if i < 0 {
+		return src, ""
+	}
+
+	base, subdir := src[:offset+i], src[offset+i+2:]
+	if j := strings.Index(subdir, "?"); j >= 0 {
+		base, subdir = base+subdir[j:], subdir[:j]
+	}
+
+	return base, strings.Trim(subdir, "/")
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/discard"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_manager_parseSource(t *testing.T) {
+	// File system
+	fs := afero.NewMemMapFs()
+	_ = fs.MkdirAll("/templates", 0755)
+	_ = fs.MkdirAll("/checkout/.git", 0755)
+	_ = fs.MkdirAll("/bare/objects", 0755)
+	_ = fs.MkdirAll("/bare/refs", 0755)
+	_ = afero.WriteFile(fs, "/bare/HEAD", []byte("ref: refs/heads/master"), 0644)
+	_ = fs.MkdirAll("/directory.git", 0755)
+	_ = afero.WriteFile(fs, "/file", []byte{}, 0644)
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	mgr := NewManager(fs, logger, "", false, Options{})
+
+	tests := []struct {
+		src          string
+		wantKind     sourceKind
+		wantLocation string
+		wantErr      bool
+	}{
+		{"git@github.com:foo/bar.git", sourceGit, "git@github.com:foo/bar.git", false},
+		{"github.com:foo/bar", sourceGit, "github.com:foo/bar", false},
+		{"https://github.com/foo/bar", sourceGit, "https://github.com/foo/bar", false},
+		{"ssh://git@github.com/foo/bar", sourceGit, "ssh://git@github.com/foo/bar", false},
+		{"file:///foo/bar", sourceGit, "file:///foo/bar", false},
+		{"git::/templates", sourceGit, "/templates", false},
+		{"https://example.com/foo.tar.gz", sourceArchive, "https://example.com/foo.tar.gz", false},
+		{"/templates", sourceDirectory, "/templates", false},
+		{"builtin", sourceBuiltin, "builtin", false},
+		{"git::/checkout", sourceGit, "/checkout", false},
+		{"/checkout", sourceDirectory, "/checkout", false},
+		{"/bare", sourceGit, "/bare", false},
+		{"/directory.git", sourceDirectory, "/directory.git", false},
+		{"/file", 0, "", true},
+		{"/missing", 0, "", true},
+		{`C:\templates`, 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			kind, location, err := mgr.parseSource(tt.src)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantKind, kind)
+			assert.Equal(t, tt.wantLocation, location)
+		})
+	}
+}
+
+func Test_splitSourceSubdir(t *testing.T) {
+	tests := []struct {
+		src        string
+		wantBase   string
+		wantSubdir string
+	}{
+		{"https://github.com/foo/bar.git", "https://github.com/foo/bar.git", ""},
+		{"https://github.com/foo/bar.git//baz/qux", "https://github.com/foo/bar.git", "baz/qux"},
+		{"git@github.com:foo/bar.git//baz/", "git@github.com:foo/bar.git", "baz"},
+		{"git::file:///foo/bar//baz", "git::file:///foo/bar", "baz"},
+		{"/foo/bar//baz", "/foo/bar", "baz"},
+		{"https://example.com/foo.tar.gz//bar?checksum=md5:abcd", "https://example.com/foo.tar.gz?checksum=md5:abcd", "bar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			base, subdir := splitSourceSubdir(tt.src)
+			assert.Equal(t, tt.wantBase, base)
+			assert.Equal(t, tt.wantSubdir, subdir)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package syncer
 import (
 	"bytes"
 	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"github.com/Masterminds/sprig"
 	"github.com/apex/log"
@@ -38,6 +39,24 @@ func (e *SourceNotExistError) Error() string {
 
 type FileHookFunc func(src string, srcContent []byte, dst string) (string, []byte, string, error)
 
+/***********/
+/* Changes */
+/***********/
+
+type ChangeType string
+
+const (
+	ChangeCreate ChangeType = "create"
+	ChangeUpdate ChangeType = "update"
+	ChangeDelete ChangeType = "delete"
+	ChangeMode   ChangeType = "mode"
+)
+
+type Change struct {
+	Type ChangeType
+	Path string
+}
+
 /**********/
 /* Syncer */
 /**********/
@@ -46,7 +65,12 @@ type Interface interface {
 	Sync(dst string, dstFs afero.Fs, src string, srcFs afero.Fs) error
 	SyncProject(prj project.Interface, tmplMgr template.ManagerInterface) error
 	SetFileHook(hook FileHookFunc)
+	SetDryRun(dryRun bool)
+	GetChanges() []*Change
+	GetSums() map[string]string
 	TemplateHook(content interface{}) FileHookFunc
+	Render(name string, content []byte, data interface{}) ([]byte, error)
+	WithLogger(logger log.Interface) Interface
 }
 
 func New(logger log.Interface) *syncer {
@@ -61,16 +85,62 @@ type syncer struct {
 	delete bool
 	// File hook
 	fileHook FileHookFunc
+	// Set this to true to only compute changes, without touching the destination.
+	dryRun bool
+	// Changes made (or that would have been made, in dry run) by syncs
+	changes []*Change
+	// Synced files content checksums, by destination
+	sums map[string]string
 	// Logger
 	logger log.Interface
 }
 
+// Get a new syncer, sharing configuration but not state, so that projects could be synced concurrently
+func (snc *syncer) WithLogger(logger log.Interface) Interface {
+	return &syncer{
+		delete:   snc.delete,
+		fileHook: snc.fileHook,
+		logger:   logger,
+	}
+}
+
 func (snc *syncer) SetFileHook(hook FileHookFunc) {
 	snc.fileHook = hook
 }
 
+func (snc *syncer) SetDryRun(dryRun bool) {
+	snc.dryRun = dryRun
+}
+
+// Get changes made since last project sync
+func (snc *syncer) GetChanges() []*Change {
+	return snc.changes
+}
+
+// Get synced files content checksums since last project sync, by destination
+func (snc *syncer) GetSums() map[string]string {
+	return snc.sums
+}
+
+func (snc *syncer) sum(dst string, content []byte) {
+	if snc.sums == nil {
+		snc.sums = make(map[string]string)
+	}
+	hash := md5.Sum(content)
+	snc.sums[dst] = hex.EncodeToString(hash[:])
+}
+
+func (snc *syncer) change(typ ChangeType, path string) {
+	snc.changes = append(snc.changes, &Change{
+		Type: typ,
+		Path: path,
+	})
+}
+
 func (snc *syncer) SyncProject(prj project.Interface, tmplMgr template.ManagerInterface) error {
 	snc.SetFileHook(snc.TemplateHook(prj.GetOptions()))
+	snc.changes = nil
+	snc.sums = nil
 
 	// Get template
 	tmpl, err := tmplMgr.Get(prj.GetTemplate())
@@ -81,7 +151,7 @@ func (snc *syncer) SyncProject(prj project.Interface, tmplMgr template.ManagerIn
 	for _, unit := range tmpl.GetSync() {
 		srcFs := tmpl.GetFs()
 		if unit.Template != "" {
-			srcTpl, err := tmplMgr.Get(unit.Template)
+			srcTpl, err := template.GetParent(tmplMgr, tmpl, unit.Template)
 			if err != nil {
 				return err
 			}
@@ -98,6 +168,12 @@ func (snc *syncer) SyncProject(prj project.Interface, tmplMgr template.ManagerIn
 
 // Updates dst to match with src, handling both files and directories.
 func (snc *syncer) Sync(dst string, dstFs afero.Fs, src string, srcFs afero.Fs) error {
+	return snc.sync(dst, dstFs, src, srcFs, false)
+}
+
+// In dry run, replaced tells dst lies below a destination file that would have been replaced by a directory,
+// so that it is known to be missing, without any stat that would fail on that file
+func (snc *syncer) sync(dst string, dstFs afero.Fs, src string, srcFs afero.Fs, replaced bool) error {
 	// Source info
 	srcInfo, srcErr := srcFs.Stat(src)
 
@@ -121,30 +197,42 @@ func (snc *syncer) Sync(dst string, dstFs afero.Fs, src string, srcFs afero.Fs)
 		}).Debug("Syncing directory...")
 
 		// Destination info
-		dstInfo, dstErr := dstFs.Stat(dst)
-
-		// Error other than not existing destination
-		if dstErr != nil && !os.IsNotExist(dstErr) {
-			return dstErr
+		var dstInfo os.FileInfo
+		if !replaced {
+			var dstErr error
+			dstInfo, dstErr = dstFs.Stat(dst)
+
+			// Error other than not existing destination
+			if dstErr != nil && !os.IsNotExist(dstErr) {
+				return dstErr
+			}
 		}
 
 		// Make destination if necessary
 		if dstInfo == nil {
 			// Destination does not exist; create directory
-			err := dstFs.MkdirAll(dst, 0755)
-			if err != nil {
-				return err
+			if !snc.dryRun {
+				err := dstFs.MkdirAll(dst, 0755)
+				if err != nil {
+					return err
+				}
 			}
 		} else if !dstInfo.IsDir() {
 			// Destination is a file; remove and create directory
-			err := dstFs.Remove(dst)
-			if err != nil {
-				return err
-			}
+			snc.change(ChangeDelete, dst)
 
-			err = dstFs.MkdirAll(dst, 0755)
-			if err != nil {
-				return err
+			if snc.dryRun {
+				replaced = true
+			} else {
+				err := dstFs.Remove(dst)
+				if err != nil {
+					return err
+				}
+
+				err = dstFs.MkdirAll(dst, 0755)
+				if err != nil {
+					return err
+				}
 			}
 		}
 
@@ -164,7 +252,7 @@ func (snc *syncer) Sync(dst string, dstFs afero.Fs, src string, srcFs afero.Fs)
 			dstFile := filepath.Join(dst, file.Name())
 			srcFile := filepath.Join(src, file.Name())
 			if file.IsDir() {
-				err = snc.Sync(dstFile, dstFs, srcFile, srcFs)
+				err = snc.sync(dstFile, dstFs, srcFile, srcFs, replaced)
 				if err != nil {
 					return err
 				}
@@ -181,7 +269,7 @@ func (snc *syncer) Sync(dst string, dstFs afero.Fs, src string, srcFs afero.Fs)
 					}
 				}
 
-				dstFile, err = snc.syncFile(dstFile, dstFs, srcFile, srcFs, srcFileInfo)
+				dstFile, err = snc.syncFile(dstFile, dstFs, srcFile, srcFs, srcFileInfo, replaced)
 				if err != nil {
 					return err
 				}
@@ -190,7 +278,8 @@ func (snc *syncer) Sync(dst string, dstFs afero.Fs, src string, srcFs afero.Fs)
 		}
 
 		// Delete files from destination that does not exist in source
-		if snc.delete {
+		// In dry run, destination directory may not have been created
+		if snc.delete && (!snc.dryRun || (dstInfo != nil && dstInfo.IsDir())) {
 			files, err = afero.ReadDir(dstFs, dst)
 			if err != nil {
 				return err
@@ -198,6 +287,12 @@ func (snc *syncer) Sync(dst string, dstFs afero.Fs, src string, srcFs afero.Fs)
 
 			for _, file := range files {
 				if !m[file.Name()] {
+					snc.change(ChangeDelete, filepath.Join(dst, file.Name()))
+
+					if snc.dryRun {
+						continue
+					}
+
 					err = dstFs.RemoveAll(filepath.Join(dst, file.Name()))
 					if err != nil {
 						return err
@@ -213,12 +308,12 @@ func (snc *syncer) Sync(dst string, dstFs afero.Fs, src string, srcFs afero.Fs)
 	/* File */
 	/* **** */
 
-	_, err := snc.syncFile(dst, dstFs, src, srcFs, srcInfo)
+	_, err := snc.syncFile(dst, dstFs, src, srcFs, srcInfo, replaced)
 
 	return err
 }
 
-func (snc *syncer) syncFile(dst string, dstFs afero.Fs, src string, srcFs afero.Fs, srcInfo os.FileInfo) (string, error) {
+func (snc *syncer) syncFile(dst string, dstFs afero.Fs, src string, srcFs afero.Fs, srcInfo os.FileInfo, replaced bool) (string, error) {
 	snc.logger.WithFields(log.Fields{
 		"src": src,
 		"dst": dst,
@@ -238,27 +333,39 @@ func (snc *syncer) syncFile(dst string, dstFs afero.Fs, src string, srcFs afero.
 		}
 	}
 
+	snc.sum(dst, srcContent)
+
 	// Destination info
-	dstInfo, dstErr := dstFs.Stat(dst)
+	var dstInfo os.FileInfo
+	var dstErr error = os.ErrNotExist
+	if !replaced {
+		dstInfo, dstErr = dstFs.Stat(dst)
 
-	// Error other than not existing destination
-	if dstErr != nil && !os.IsNotExist(dstErr) {
-		return "", dstErr
+		// Error other than not existing destination
+		if dstErr != nil && !os.IsNotExist(dstErr) {
+			return "", dstErr
+		}
 	}
 
 	// Delete destination if it's a directory
 	if dstInfo != nil && dstInfo.IsDir() {
-		err = dstFs.RemoveAll(dst)
-		if err != nil {
-			return "", err
-		}
+		snc.change(ChangeDelete, dst)
 
-		// Destination info
-		dstInfo, dstErr = dstFs.Stat(dst)
+		if snc.dryRun {
+			dstInfo, dstErr = nil, os.ErrNotExist
+		} else {
+			err = dstFs.RemoveAll(dst)
+			if err != nil {
+				return "", err
+			}
 
-		// Error other than not existing destination
-		if dstErr != nil && !os.IsNotExist(dstErr) {
-			return "", dstErr
+			// Destination info
+			dstInfo, dstErr = dstFs.Stat(dst)
+
+			// Error other than not existing destination
+			if dstErr != nil && !os.IsNotExist(dstErr) {
+				return "", dstErr
+			}
 		}
 	}
 
@@ -270,6 +377,14 @@ func (snc *syncer) syncFile(dst string, dstFs afero.Fs, src string, srcFs afero.
 	}
 
 	if !eq {
+		if dstInfo == nil {
+			snc.change(ChangeCreate, dst)
+		} else {
+			snc.change(ChangeUpdate, dst)
+		}
+	}
+
+	if !eq && !snc.dryRun {
 		// Create directory if needed.
 		dstDir := filepath.Dir(dst)
 		if dstDir != "." {
@@ -308,6 +423,15 @@ func (snc *syncer) syncFile(dst string, dstFs afero.Fs, src string, srcFs afero.
 		}
 
 		if dstMode != dstModeSync {
+			// Content changes already account for the file
+			if eq {
+				snc.change(ChangeMode, dst)
+			}
+
+			if snc.dryRun {
+				return dst, nil
+			}
+
 			err := dstFs.Chmod(dst, dstModeSync)
 			if err != nil {
 				return "", err
@@ -360,32 +484,40 @@ func (snc *syncer) TemplateHook(content interface{}) FileHookFunc {
 			"dst": dst,
 		}).Debug("Syncing file template...")
 
-		// Sprig functions
-		funcs := sprig.TxtFuncMap()
-
-		// Extra functions
-		funcs["toYaml"] = func(v interface{}) string {
-			content, err := yaml.Marshal(v)
-			if err != nil {
-				return ""
-			}
-			return string(content)
-		}
-
-		tmpl, err := engine.New(src).Funcs(funcs).Parse(string(srcContent))
+		srcContent, err := snc.Render(src, srcContent, content)
 		if err != nil {
 			return "", nil, "", err
 		}
 
-		var tmplContent bytes.Buffer
+		return src, srcContent, dst, nil
+	}
+}
+
+// Render content as a template, using data
+func (snc *syncer) Render(name string, content []byte, data interface{}) ([]byte, error) {
+	// Sprig functions
+	funcs := sprig.TxtFuncMap()
 
-		err = tmpl.Execute(&tmplContent, content)
+	// Extra functions
+	funcs["toYaml"] = func(v interface{}) string {
+		content, err := yaml.Marshal(v)
 		if err != nil {
-			return "", nil, "", err
+			return ""
 		}
+		return string(content)
+	}
 
-		srcContent = tmplContent.Bytes()
+	tmpl, err := engine.New(name).Funcs(funcs).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
 
-		return src, srcContent, dst, nil
+	var tmplContent bytes.Buffer
+
+	err = tmpl.Execute(&tmplContent, data)
+	if err != nil {
+		return nil, err
 	}
+
+	return tmplContent.Bytes(), nil
 }
@@ -5,6 +5,11 @@ import (
 	"github.com/apex/log/handlers/discard"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"manala/pkg/project"
+	"manala/pkg/repository"
+	"manala/pkg/template"
+	"os"
 	"testing"
 )
 
@@ -184,3 +189,151 @@ func Test_syncer_Sync_executable(t *testing.T) {
 		})
 	}
 }
+
+func Test_syncer_Sync_dryRun(t *testing.T) {
+	// Source file system
+	srcFs := afero.NewBasePathFs(
+		afero.NewOsFs(),
+		"testdata/fs",
+	)
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+
+	type args struct {
+		dst string
+		src string
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantChanges []*Change
+	}{
+		{
+			"file_not_exist",
+			args{dst: "foo", src: "foo"},
+			[]*Change{{Type: ChangeCreate, Path: "foo"}},
+		},
+		{
+			"file_exist_same",
+			args{dst: "file_bar", src: "foo"},
+			nil,
+		},
+		{
+			"file_exist_differs",
+			args{dst: "file_foo", src: "foo"},
+			[]*Change{{Type: ChangeUpdate, Path: "file_foo"}},
+		},
+		{
+			"file_exist_executable",
+			args{dst: "file_bar", src: "executable_true"},
+			[]*Change{{Type: ChangeUpdate, Path: "file_bar"}},
+		},
+		{
+			"file_exist_same_mode_differs",
+			args{dst: "executable_false", src: "executable_true"},
+			[]*Change{{Type: ChangeMode, Path: "executable_false"}},
+		},
+		{
+			"source_file_over_destination_directory",
+			args{dst: "dir", src: "foo"},
+			[]*Change{{Type: ChangeDelete, Path: "dir"}, {Type: ChangeCreate, Path: "dir"}},
+		},
+		{
+			"directory_not_exist",
+			args{dst: "bar", src: "bar"},
+			[]*Change{{Type: ChangeCreate, Path: "bar/foo"}},
+		},
+		{
+			"directory_exist",
+			args{dst: "dir", src: "bar"},
+			[]*Change{{Type: ChangeUpdate, Path: "dir/foo"}, {Type: ChangeDelete, Path: "dir/bar"}},
+		},
+		{
+			"source_directory_over_destination_file",
+			args{dst: "file_foo", src: "bar"},
+			[]*Change{{Type: ChangeDelete, Path: "file_foo"}, {Type: ChangeCreate, Path: "file_foo/foo"}},
+		},
+		{
+			"source_nested_directory_over_destination_file",
+			args{dst: "file_foo", src: "nested"},
+			[]*Change{{Type: ChangeDelete, Path: "file_foo"}, {Type: ChangeCreate, Path: "file_foo/bar/foo"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Syncer
+			snc := &syncer{
+				delete: true,
+				dryRun: true,
+				logger: logger,
+			}
+
+			// Destination file system, os backed, so that stats below files fail as they would for real
+			dir, _ := ioutil.TempDir("", "manala")
+			defer os.RemoveAll(dir)
+			dstFs := afero.NewBasePathFs(afero.NewOsFs(), dir)
+			_ = afero.WriteFile(dstFs, "file_foo", []byte("foo"), 0666)
+			_ = afero.WriteFile(dstFs, "file_bar", []byte("bar"), 0666)
+			_ = dstFs.Mkdir("dir", 0755)
+			_ = afero.WriteFile(dstFs, "dir/foo", []byte("bar"), 0666)
+			_ = dstFs.Mkdir("dir/bar", 0755)
+			_ = afero.WriteFile(dstFs, "executable_false", []byte(""), 0666)
+			_ = dstFs.Chmod("executable_false", 0666)
+
+			err := snc.Sync(tt.args.dst, dstFs, tt.args.src, srcFs)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantChanges, snc.GetChanges())
+			assert.NotEmpty(t, snc.GetSums())
+
+			// Destination file system must be left untouched
+			content, _ := afero.ReadFile(dstFs, "file_foo")
+			assert.Equal(t, "foo", string(content))
+			exists, _ := afero.DirExists(dstFs, "dir/bar")
+			assert.True(t, exists)
+			exists, _ = afero.Exists(dstFs, tt.args.dst)
+			assert.Equal(t, tt.args.dst != "foo" && tt.args.dst != "bar", exists)
+			exists, _ = afero.IsDir(dstFs, "file_foo")
+			assert.False(t, exists)
+			info, _ := dstFs.Stat("executable_false")
+			assert.Equal(t, os.FileMode(0666), info.Mode().Perm())
+		})
+	}
+}
+
+func Test_syncer_SyncProject_parent(t *testing.T) {
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+	// Template manager
+	tmplMgr := template.NewMultiRepositoryManager(
+		repository.NewManager(
+			afero.NewBasePathFs(afero.NewOsFs(), "testdata/repositories"),
+			logger,
+			"",
+			false,
+			repository.Options{},
+		),
+		logger,
+		[]string{"first", "second"},
+	)
+	// Project
+	prjFs := afero.NewBasePathFs(afero.NewMemMapFs(), "/")
+	_ = afero.WriteFile(prjFs, ".manala.yaml", []byte("manala:\n  template: foo\n"), 0666)
+	prj, _ := project.NewManager(prjFs, logger, project.Options{}).Create(prjFs)
+
+	snc := New(logger)
+
+	err := snc.SyncProject(prj, tmplMgr)
+	assert.Nil(t, err)
+
+	// Unqualified parent template is resolved within child template repository
+	content, _ := afero.ReadFile(prjFs, "file")
+	assert.Equal(t, "second\n", string(content))
+
+	// Qualified one, within its own repository
+	content, _ = afero.ReadFile(prjFs, "file_first")
+	assert.Equal(t, "first\n", string(content))
+}
@@ -10,6 +10,7 @@ import (
 	"manala/pkg/repository"
 	"path"
 	"strings"
+	"sync"
 )
 
 /**********/
@@ -39,13 +40,23 @@ var supportedConfigNames = []*struct {
 
 type ManagedTemplate struct {
 	Interface
-	dir string
+	dir        string
+	repository *repository.ManagedRepository
 }
 
 func (tmpl *ManagedTemplate) GetDir() string {
 	return tmpl.dir
 }
 
+func (tmpl *ManagedTemplate) GetRepository() *repository.ManagedRepository {
+	return tmpl.repository
+}
+
+// Get template name, qualified by its repository one
+func (tmpl *ManagedTemplate) GetQualifiedName() string {
+	return tmpl.repository.GetName() + "/" + tmpl.GetName()
+}
+
 /***********/
 /* Manager */
 /***********/
@@ -55,6 +66,7 @@ type ManagerInterface interface {
 	Walk(fn ManagerWalkFunc) error
 	Get(name string) (*ManagedTemplate, error)
 	WithRepositorySrc(src string) ManagerInterface
+	WithRepositoryRef(ref string) ManagerInterface
 }
 
 type manager struct {
@@ -62,16 +74,27 @@ type manager struct {
 	logger            log.Interface
 	repositories      map[string]*repository.ManagedRepository
 	templates         map[string]map[string]*ManagedTemplate
+	// Stores are shared by concurrent projects syncs
+	repositoriesMutex sync.Mutex
+	templatesMutex    sync.Mutex
+}
+
+func newManager(repositoryManager repository.ManagerInterface, logger log.Interface) *manager {
+	return &manager{
+		repositoryManager: repositoryManager,
+		logger:            logger,
+		repositories:      make(map[string]*repository.ManagedRepository),
+		templates:         make(map[string]map[string]*ManagedTemplate),
+	}
 }
 
+/*****************************/
+/* Single Repository Manager */
+/*****************************/
+
 func NewSingleRepositoryManager(repositoryManager repository.ManagerInterface, logger log.Interface, repositorySrc string) *singleRepositoryManager {
 	return &singleRepositoryManager{
-		manager: &manager{
-			repositoryManager: repositoryManager,
-			logger:            logger,
-			repositories:      make(map[string]*repository.ManagedRepository),
-			templates:         make(map[string]map[string]*ManagedTemplate),
-		},
+		manager:       newManager(repositoryManager, logger),
 		repositorySrc: repositorySrc,
 	}
 }
@@ -79,9 +102,10 @@ func NewSingleRepositoryManager(repositoryManager repository.ManagerInterface, l
 type singleRepositoryManager struct {
 	*manager
 	repositorySrc string
+	repositoryRef string
 }
 
-func (mgr *singleRepositoryManager) Create(name string, fs afero.Fs) (*template, error) {
+func (mgr *manager) Create(name string, fs afero.Fs) (*template, error) {
 	vpr := viper.New()
 	vpr.SetFs(fs)
 
@@ -145,32 +169,43 @@ func (mgr *singleRepositoryManager) Create(name string, fs afero.Fs) (*template,
 }
 
 // Get repository
-func (mgr *singleRepositoryManager) getRepository(src string) (*repository.ManagedRepository, error) {
+func (mgr *manager) getRepository(src string, ref string) (*repository.ManagedRepository, error) {
+	key := repositoryKey(src, ref)
+
+	// Repository creation is held under lock, so that it never happens twice
+	mgr.repositoriesMutex.Lock()
+	defer mgr.repositoriesMutex.Unlock()
+
 	// Check if repository already in store
-	if rep, ok := mgr.repositories[src]; ok {
+	if rep, ok := mgr.repositories[key]; ok {
 		return rep, nil
 	}
 
 	// Create repository
-	rep, err := mgr.repositoryManager.Create(src)
+	rep, err := mgr.repositoryManager.Create(src, ref)
 	if err != nil {
 		// Todo: what about storing "nil" value for template name to speed up next error resolving ?
 		return nil, err
 	}
 
-	// Store repository
-	mgr.repositories[src] = rep
+	// Store repository, also by its resolved source, as templates refer to it
+	mgr.repositories[key] = rep
+	mgr.repositories[repositoryKey(rep.GetSrc(), ref)] = rep
 
 	return rep, nil
 }
 
 // Get template
-func (mgr *singleRepositoryManager) getTemplate(name string, rep *repository.ManagedRepository) (*ManagedTemplate, error) {
+func (mgr *manager) getTemplate(name string, rep *repository.ManagedRepository, ref string) (*ManagedTemplate, error) {
+	key := repositoryKey(rep.GetSrc(), ref)
 
-	templates, ok := mgr.templates[rep.GetSrc()]
+	mgr.templatesMutex.Lock()
+	defer mgr.templatesMutex.Unlock()
+
+	templates, ok := mgr.templates[key]
 	if !ok {
-		mgr.templates[rep.GetSrc()] = make(map[string]*ManagedTemplate)
-		templates = mgr.templates[rep.GetSrc()]
+		mgr.templates[key] = make(map[string]*ManagedTemplate)
+		templates = mgr.templates[key]
 	}
 
 	// Check if template already in store
@@ -194,8 +229,9 @@ func (mgr *singleRepositoryManager) getTemplate(name string, rep *repository.Man
 	}
 
 	mgrTmpl := &ManagedTemplate{
-		Interface: tmpl,
-		dir:       path.Join(rep.GetDir(), name),
+		Interface:  tmpl,
+		dir:        path.Join(rep.GetDir(), name),
+		repository: rep,
 	}
 
 	// Store template
@@ -206,14 +242,8 @@ func (mgr *singleRepositoryManager) getTemplate(name string, rep *repository.Man
 
 type ManagerWalkFunc func(tmpl *ManagedTemplate)
 
-// Walk into templates
-func (mgr *singleRepositoryManager) Walk(fn ManagerWalkFunc) error {
-	// Get repository
-	rep, err := mgr.getRepository(mgr.repositorySrc)
-	if err != nil {
-		return err
-	}
-
+// Walk into repository templates
+func (mgr *manager) walkRepository(rep *repository.ManagedRepository, ref string, fn ManagerWalkFunc) error {
 	files, err := afero.ReadDir(rep.GetFs(), "")
 	if err != nil {
 		mgr.logger.WithError(err).Fatal("Error walking into templates")
@@ -225,7 +255,7 @@ func (mgr *singleRepositoryManager) Walk(fn ManagerWalkFunc) error {
 			continue
 		}
 		if file.IsDir() {
-			tmpl, err := mgr.getTemplate(file.Name(), rep)
+			tmpl, err := mgr.getTemplate(file.Name(), rep, ref)
 			if err != nil {
 				return err
 			}
@@ -237,15 +267,26 @@ func (mgr *singleRepositoryManager) Walk(fn ManagerWalkFunc) error {
 	return nil
 }
 
+// Walk into templates
+func (mgr *singleRepositoryManager) Walk(fn ManagerWalkFunc) error {
+	// Get repository
+	rep, err := mgr.getRepository(mgr.repositorySrc, mgr.repositoryRef)
+	if err != nil {
+		return err
+	}
+
+	return mgr.walkRepository(rep, mgr.repositoryRef, fn)
+}
+
 // Get template
 func (mgr *singleRepositoryManager) Get(name string) (*ManagedTemplate, error) {
 	// Get repository
-	repo, err := mgr.getRepository(mgr.repositorySrc)
+	repo, err := mgr.getRepository(mgr.repositorySrc, mgr.repositoryRef)
 	if err != nil {
 		return nil, err
 	}
 
-	return mgr.getTemplate(name, repo)
+	return mgr.getTemplate(name, repo, mgr.repositoryRef)
 }
 
 // With repository source
@@ -253,5 +294,158 @@ func (mgr *singleRepositoryManager) WithRepositorySrc(src string) ManagerInterfa
 	return &singleRepositoryManager{
 		manager:       mgr.manager,
 		repositorySrc: src,
+		repositoryRef: mgr.repositoryRef,
+	}
+}
+
+// With repository ref
+func (mgr *singleRepositoryManager) WithRepositoryRef(ref string) ManagerInterface {
+	return &singleRepositoryManager{
+		manager:       mgr.manager,
+		repositorySrc: mgr.repositorySrc,
+		repositoryRef: ref,
+	}
+}
+
+// Get parent template of tmpl, as referred by its sync units.
+// Parent is resolved within tmpl own repository, unless qualified by another one.
+func GetParent(mgr ManagerInterface, tmpl *ManagedTemplate, name string) (*ManagedTemplate, error) {
+	if strings.Contains(name, "/") {
+		return mgr.Get(name)
+	}
+
+	return mgr.WithRepositorySrc(tmpl.GetRepository().GetSrc()).Get(name)
+}
+
+// Repositories, and their templates, are stored by source and ref
+func repositoryKey(src string, ref string) string {
+	if ref == "" {
+		return src
+	}
+
+	return src + "#" + ref
+}
+
+/****************************/
+/* Multi Repository Manager */
+/****************************/
+
+// Resolve templates through an ordered list of repositories, first ones taking priority.
+// Templates could also be explicitly qualified by their repository name, as in "repository/template".
+func NewMultiRepositoryManager(repositoryManager repository.ManagerInterface, logger log.Interface, repositorySrcs []string) *multiRepositoryManager {
+	return &multiRepositoryManager{
+		manager:        newManager(repositoryManager, logger),
+		repositorySrcs: repositorySrcs,
+	}
+}
+
+type multiRepositoryManager struct {
+	*manager
+	repositorySrcs []string
+	repositoryRef  string
+}
+
+// Walk into templates of all repositories, by priority.
+// Unusable repositories are skipped, as long as another one could be walked into.
+func (mgr *multiRepositoryManager) Walk(fn ManagerWalkFunc) error {
+	var firstErr error
+	walked := false
+
+	for _, src := range mgr.repositorySrcs {
+		// Get repository
+		rep, err := mgr.getRepository(src, mgr.repositoryRef)
+		if err != nil {
+			mgr.skipRepository(src, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		err = mgr.walkRepository(rep, mgr.repositoryRef, fn)
+		if err != nil {
+			return err
+		}
+
+		walked = true
+	}
+
+	if !walked {
+		return firstErr
+	}
+
+	return nil
+}
+
+// Get template from the first repository providing it.
+// Unusable repositories are only skipped in favour of the builtin one, as any other
+// lower priority one could provide an unrelated template of the same name.
+func (mgr *multiRepositoryManager) Get(name string) (*ManagedTemplate, error) {
+	// Qualified template
+	qualifier := ""
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		qualifier, name = name[:i], name[i+1:]
+	}
+
+	var unusableErr error
+
+	for _, src := range mgr.repositorySrcs {
+		// Qualified template only looks into its own repository
+		if qualifier != "" && mgr.repositoryManager.Name(src) != qualifier {
+			continue
+		}
+
+		// Only builtin repository is left as a fallback once one is unusable
+		if unusableErr != nil && src != repository.BuiltinSrc {
+			continue
+		}
+
+		rep, err := mgr.getRepository(src, mgr.repositoryRef)
+		if err != nil {
+			// Pinned ref could only exist in some repositories
+			if errors.Is(err, repository.ErrRefNotFound) {
+				continue
+			}
+			if unusableErr == nil {
+				unusableErr = err
+			}
+			mgr.skipRepository(src, err)
+			continue
+		}
+
+		tmpl, err := mgr.getTemplate(name, rep, mgr.repositoryRef)
+		if err == ErrNotFound && qualifier == "" {
+			continue
+		}
+
+		return tmpl, err
+	}
+
+	if unusableErr != nil {
+		return nil, unusableErr
+	}
+
+	return nil, ErrNotFound
+}
+
+func (mgr *multiRepositoryManager) skipRepository(src string, err error) {
+	mgr.logger.WithError(err).WithField("repository", src).Warn("Skipping unusable repository")
+}
+
+// With repository source, overriding all others
+func (mgr *multiRepositoryManager) WithRepositorySrc(src string) ManagerInterface {
+	return &singleRepositoryManager{
+		manager:       mgr.manager,
+		repositorySrc: src,
+		repositoryRef: mgr.repositoryRef,
+	}
+}
+
+// With repository ref
+func (mgr *multiRepositoryManager) WithRepositoryRef(ref string) ManagerInterface {
+	return &multiRepositoryManager{
+		manager:        mgr.manager,
+		repositorySrcs: mgr.repositorySrcs,
+		repositoryRef:  ref,
 	}
 }
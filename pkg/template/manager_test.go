@@ -3,9 +3,11 @@ package template
 import (
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/discard"
+	"github.com/asaskevich/govalidator"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"manala/pkg/repository"
+	"sync"
 	"testing"
 )
 
@@ -26,6 +28,7 @@ func Test_manager_Create(t *testing.T) {
 			logger,
 			"",
 			false,
+			repository.Options{},
 		),
 		logger,
 		"",
@@ -39,6 +42,11 @@ func Test_manager_Create(t *testing.T) {
 		name        string
 		description string
 		sync        []SyncUnit
+		hooks       Hooks
+		version     string
+		migrations  []Migration
+		options     []Option
+		tags        []string
 	}
 	tests := []struct {
 		name    string
@@ -69,6 +77,39 @@ func Test_manager_Create(t *testing.T) {
 			}},
 			nil,
 		},
+		{
+			"template_hooks",
+			args{name: "foo", fs: afero.NewBasePathFs(fs, "template_hooks")},
+			&want{name: "foo", description: "Foo", sync: nil, hooks: Hooks{
+				PreSync:  []string{"echo foo"},
+				PostSync: []string{"echo {{ .foo }}", "echo bar"},
+			}},
+			nil,
+		},
+		{
+			"template_migrations",
+			args{name: "foo", fs: afero.NewBasePathFs(fs, "template_migrations")},
+			&want{name: "foo", description: "Foo", sync: nil, version: "2.0.0", migrations: []Migration{
+				{Version: "2.0.0", Steps: []MigrationStep{{RenameOption: &MigrationPair{From: "foo", To: "bar"}}, {Move: &MigrationPair{From: "foo bar", To: "baz"}}}},
+				{Version: "1.1.0", Steps: []MigrationStep{{Delete: "baz"}}},
+			}},
+			nil,
+		},
+		{
+			"template_options",
+			args{name: "foo", fs: afero.NewBasePathFs(fs, "template_options")},
+			&want{name: "foo", description: "Foo", sync: nil, options: []Option{
+				{Name: "foo", Default: "bar", Description: "Foo option"},
+				{Name: "bar"},
+			}, tags: []string{"foo", "bar"}},
+			nil,
+		},
+		{
+			"template_version_invalid",
+			args{name: "foo", fs: afero.NewBasePathFs(fs, "template_version_invalid")},
+			nil,
+			govalidator.Errors{},
+		},
 		{
 			"template_not_found",
 			args{name: "foo", fs: afero.NewBasePathFs(fs, "template_not_found")},
@@ -91,7 +132,170 @@ func Test_manager_Create(t *testing.T) {
 				assert.Equal(t, tt.want.name, tpl.GetName())
 				assert.Equal(t, tt.want.description, tpl.GetDescription())
 				assert.Equal(t, tt.want.sync, tpl.GetSync())
+				assert.Equal(t, tt.want.hooks, tpl.GetHooks())
+				assert.Equal(t, tt.want.version, tpl.GetVersion())
+				assert.Equal(t, tt.want.migrations, tpl.GetMigrations())
+				assert.Equal(t, tt.want.options, tpl.GetOptions())
+				assert.Equal(t, tt.want.tags, tpl.GetTags())
 			}
 		})
 	}
 }
+
+func Test_multiRepositoryManager(t *testing.T) {
+	// File system
+	fs := afero.NewBasePathFs(
+		afero.NewOsFs(),
+		"testdata/repositories",
+	)
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+	// Manager
+	manager := NewMultiRepositoryManager(
+		repository.NewManager(
+			fs,
+			logger,
+			"",
+			false,
+			repository.Options{},
+		),
+		logger,
+		[]string{"first", "second"},
+	)
+
+	t.Run("walk", func(t *testing.T) {
+		var got []string
+		err := manager.Walk(func(tmpl *ManagedTemplate) {
+			got = append(got, tmpl.GetQualifiedName())
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"first/bar", "first/foo", "second/bar", "second/baz"}, got)
+	})
+
+	tests := []struct {
+		name            string
+		wantDescription string
+		wantErr         error
+	}{
+		{"foo", "First foo", nil},
+		{"bar", "First bar", nil},
+		{"baz", "Second baz", nil},
+		{"second/bar", "Second bar", nil},
+		{"first/baz", "", ErrNotFound},
+		{"third/foo", "", ErrNotFound},
+		{"qux", "", ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run("get_"+tt.name, func(t *testing.T) {
+			tmpl, err := manager.Get(tt.name)
+			assert.Equal(t, tt.wantErr, err)
+
+			if tt.wantErr == nil {
+				assert.Equal(t, tt.wantDescription, tmpl.GetDescription())
+			}
+		})
+	}
+
+	t.Run("get_parent", func(t *testing.T) {
+		tmpl, _ := manager.Get("baz")
+
+		// Within template own repository
+		parent, err := GetParent(manager, tmpl, "bar")
+		assert.Nil(t, err)
+		assert.Equal(t, "Second bar", parent.GetDescription())
+
+		// Unless qualified
+		parent, err = GetParent(manager, tmpl, "first/bar")
+		assert.Nil(t, err)
+		assert.Equal(t, "First bar", parent.GetDescription())
+	})
+}
+
+func Test_multiRepositoryManager_fallback(t *testing.T) {
+	// File system
+	fs := afero.NewBasePathFs(
+		afero.NewOsFs(),
+		"testdata/repositories",
+	)
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+	// Manager
+	manager := NewMultiRepositoryManager(
+		repository.NewManager(
+			fs,
+			logger,
+			"",
+			false,
+			repository.Options{},
+		),
+		logger,
+		[]string{"missing", "second", repository.BuiltinSrc},
+	)
+
+	// Walk skips unusable repositories
+	var got []string
+	err := manager.Walk(func(tmpl *ManagedTemplate) {
+		got = append(got, tmpl.GetQualifiedName())
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"second/bar", "second/baz", "builtin/default"}, got)
+
+	// Get never falls back on lower priority repositories
+	_, err = manager.Get("baz")
+	assert.IsType(t, &repository.Error{}, err)
+
+	// But the builtin one
+	tmpl, err := manager.Get("default")
+	assert.Nil(t, err)
+	assert.Equal(t, repository.BuiltinSrc, tmpl.GetRepository().GetSrc())
+
+	// Unless qualified by a usable one
+	tmpl, err = manager.Get("second/baz")
+	assert.Nil(t, err)
+	assert.Equal(t, "Second baz", tmpl.GetDescription())
+}
+
+func Test_multiRepositoryManager_concurrent(t *testing.T) {
+	// File system
+	fs := afero.NewBasePathFs(
+		afero.NewOsFs(),
+		"testdata/repositories",
+	)
+	// Logger
+	logger := &log.Logger{
+		Handler: discard.Default,
+	}
+	// Manager
+	manager := NewMultiRepositoryManager(
+		repository.NewManager(
+			fs,
+			logger,
+			"",
+			false,
+			repository.Options{},
+		),
+		logger,
+		[]string{"first", "second"},
+	)
+
+	var wg sync.WaitGroup
+	templates := make([]*ManagedTemplate, 8)
+	for i := range templates {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			templates[i], _ = manager.Get("baz")
+		}(i)
+	}
+	wg.Wait()
+
+	// Every get resolves the very same stored template
+	assert.NotNil(t, templates[0])
+	for _, tmpl := range templates {
+		assert.True(t, templates[0] == tmpl)
+	}
+}
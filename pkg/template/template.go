@@ -12,9 +12,9 @@ import (
 /*************/
 
 type SyncUnit struct {
-	Source      string `mapstructure:"source"`
-	Destination string `mapstructure:"destination"`
-	Template    string `mapstructure:"template"`
+	Source      string `mapstructure:"source" json:"source" yaml:"source"`
+	Destination string `mapstructure:"destination" json:"destination" yaml:"destination"`
+	Template    string `mapstructure:"template" json:"template,omitempty" yaml:"template,omitempty"`
 }
 
 // Returns a DecodeHookFunc that converts strings to syncUnit
@@ -56,6 +56,53 @@ func StringToSyncUnitHookFunc() mapstructure.DecodeHookFunc {
 	}
 }
 
+/**********/
+/* Option */
+/**********/
+
+// Options a template expects to be defined by projects
+type Option struct {
+	Name        string      `mapstructure:"name" valid:"required" json:"name" yaml:"name"`
+	Default     interface{} `mapstructure:"default" json:"default,omitempty" yaml:"default,omitempty"`
+	Description string      `mapstructure:"description" json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+/*********/
+/* Hooks */
+/*********/
+
+type Hooks struct {
+	PreSync  []string `mapstructure:"pre_sync"`
+	PostSync []string `mapstructure:"post_sync"`
+}
+
+/*************/
+/* Migration */
+/*************/
+
+type Migration struct {
+	Version string          `mapstructure:"version" valid:"required,semver"`
+	Steps   []MigrationStep `mapstructure:"steps"`
+}
+
+// A migration step holds one, and only one, operation
+type MigrationStep struct {
+	// Rename an option key (dot separated keys)
+	RenameOption *MigrationPair `mapstructure:"rename_option"`
+	// Delete an option key (dot separated keys)
+	DeleteOption string `mapstructure:"delete_option"`
+	// Move a project file or directory
+	Move *MigrationPair `mapstructure:"move"`
+	// Delete a project file or directory
+	Delete string `mapstructure:"delete"`
+}
+
+// Migration step source and destination, as in {from: foo, to: bar}
+type MigrationPair struct {
+	From string `mapstructure:"from"`
+	To   string `mapstructure:"to"`
+}
+
 /************/
 /* Template */
 /************/
@@ -65,11 +112,21 @@ type Interface interface {
 	GetFs() afero.Fs
 	GetDescription() string
 	GetSync() []SyncUnit
+	GetHooks() Hooks
+	GetVersion() string
+	GetMigrations() []Migration
+	GetOptions() []Option
+	GetTags() []string
 }
 
 type config struct {
-	Description string     `mapstructure:"description" valid:"required"`
-	Sync        []SyncUnit `mapstructure:"sync"`
+	Description string      `mapstructure:"description" valid:"required"`
+	Sync        []SyncUnit  `mapstructure:"sync"`
+	Hooks       Hooks       `mapstructure:"hooks"`
+	Version     string      `mapstructure:"version" valid:"semver"`
+	Migrations  []Migration `mapstructure:"migrations"`
+	Options     []Option    `mapstructure:"options"`
+	Tags        []string    `mapstructure:"tags"`
 }
 
 type template struct {
@@ -93,3 +150,23 @@ func (tpl *template) GetDescription() string {
 func (tpl *template) GetSync() []SyncUnit {
 	return tpl.config.Sync
 }
+
+func (tpl *template) GetHooks() Hooks {
+	return tpl.config.Hooks
+}
+
+func (tpl *template) GetVersion() string {
+	return tpl.config.Version
+}
+
+func (tpl *template) GetMigrations() []Migration {
+	return tpl.config.Migrations
+}
+
+func (tpl *template) GetOptions() []Option {
+	return tpl.config.Options
+}
+
+func (tpl *template) GetTags() []string {
+	return tpl.config.Tags
+}